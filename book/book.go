@@ -0,0 +1,237 @@
+// Package book is an opening book built from finished games. Positions are
+// stored in canonical form (game.Board.Canonical), so games that differ
+// only by a symmetry share their statistics.
+package book
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+
+	"game"
+)
+
+const DefaultDepth = 20 // moves of each game stored in a new book
+
+// Candidate is a book move and the results of the games that played it,
+// from the point of view of the side playing it.
+type Candidate struct {
+	Move game.Position
+	Games int
+	Wins int
+	Draws int
+	Losses int
+	DiscSum int // sum of the final disc differences
+}
+
+// Score is the share of points won, a draw counting half.
+func (c *Candidate) Score() float64 {
+	if c.Games == 0 {
+		return 0
+	}
+	return (float64(c.Wins) + float64(c.Draws)/2) / float64(c.Games)
+}
+
+// MeanDiscs is the mean final disc difference.
+func (c *Candidate) MeanDiscs() float64 {
+	if c.Games == 0 {
+		return 0
+	}
+	return float64(c.DiscSum) / float64(c.Games)
+}
+
+// Book maps canonical positions to the moves played from them. Once built,
+// a Book may be read from several goroutines at once.
+type Book struct {
+	Depth int // moves of each game added by AddGame
+	// canonical SFEN -> canonical move -> statistics
+	positions map[string]map[game.Position]*Candidate
+}
+
+func NewBook(depth int) *Book {
+	return &Book{
+		Depth: depth,
+		positions: make(map[string]map[game.Position]*Candidate),
+	}
+}
+
+// Positions returns the number of positions in the book.
+func (bk *Book) Positions() int {
+	return len(bk.positions)
+}
+
+// AddGame replays moves from start, which is not modified, and adds the
+// first Depth moves with the game's result. The game must be played to
+// the end; forfeits say nothing about the opening.
+func (bk *Book) AddGame(start *game.Board, moves []game.Position) error {
+	b := start.Copy()
+	type entry struct {
+		key string
+		move game.Position
+		turn int
+	}
+	var entries []entry
+	for i, mv := range moves {
+		if !b.IsLegalMove(mv) {
+			return fmt.Errorf("book: illegal move %d at ply %d", mv, i)
+		}
+		if i < bk.Depth {
+			canon, sym := b.Canonical()
+			cmv := canonical_move(canon, game.TransformPosition(b.Boardlen, mv, sym))
+			entries = append(entries, entry{canon.ToSFEN(), cmv, b.Turn})
+		}
+		b.MoveUpdate(mv)
+	}
+	if !b.IsGameOver() {
+		return errors.New("book: game not finished")
+	}
+	diff := b.CountBlack() - b.CountWhite()
+	for _, e := range entries {
+		moves := bk.positions[e.key]
+		if moves == nil {
+			moves = make(map[game.Position]*Candidate)
+			bk.positions[e.key] = moves
+		}
+		c := moves[e.move]
+		if c == nil {
+			c = &Candidate{Move: e.move}
+			moves[e.move] = c
+		}
+		d := diff
+		if e.turn == game.White {
+			d = -d
+		}
+		c.Games++
+		c.DiscSum += d
+		switch {
+		case d > 0:
+			c.Wins++
+		case d < 0:
+			c.Losses++
+		default:
+			c.Draws++
+		}
+	}
+	return nil
+}
+
+// canonical_move picks one move among those that a symmetry of the
+// position canon maps to each other, so that equivalent moves share their
+// statistics.
+func canonical_move(canon *game.Board, mv game.Position) game.Position {
+	key := canon.ToSFEN()
+	best := mv
+	for sym := game.Rotate90; sym < game.NumSymmetries; sym++ {
+		mv2 := game.TransformPosition(canon.Boardlen, mv, sym)
+		if mv2 < best && canon.Transform(sym).ToSFEN() == key {
+			best = mv2
+		}
+	}
+	return best
+}
+
+// Lookup returns the book moves of b, most played first, with the moves
+// mapped to b's orientation. Of moves equivalent by a symmetry of b only
+// one is listed. It returns nil for positions out of book.
+func (bk *Book) Lookup(b *game.Board) []Candidate {
+	canon, sym := b.Canonical()
+	moves := bk.positions[canon.ToSFEN()]
+	if len(moves) == 0 {
+		return nil
+	}
+	inv := sym.Inverse()
+	cands := make([]Candidate, 0, len(moves))
+	for _, c := range moves {
+		c2 := *c
+		c2.Move = game.TransformPosition(b.Boardlen, c.Move, inv)
+		cands = append(cands, c2)
+	}
+	sort.Slice(cands, func(i, j int) bool {
+		if cands[i].Games != cands[j].Games {
+			return cands[i].Games > cands[j].Games
+		}
+		return cands[i].Move < cands[j].Move
+	})
+	return cands
+}
+
+// Best returns the book move of b with the highest score among those
+// played in at least min_games games.
+func (bk *Book) Best(b *game.Board, min_games int) (Candidate, bool) {
+	var best Candidate
+	found := false
+	for _, c := range bk.Lookup(b) {
+		if c.Games >= min_games && (!found || c.Score() > best.Score()) {
+			best = c
+			found = true
+		}
+	}
+	return best, found
+}
+
+// RandomOpening plays up to plies random book moves from b, which is not
+// modified. Only moves played in at least min_games games and scoring
+// within balance of one half are chosen, so the opening stays even. It
+// stops early when no move qualifies.
+func (bk *Book) RandomOpening(b *game.Board, plies int, min_games int, balance float64, rng *rand.Rand) []game.Position {
+	b = b.Copy()
+	var moves []game.Position
+	for len(moves) < plies {
+		var choices []game.Position
+		for _, c := range bk.Lookup(b) {
+			s := c.Score()
+			if c.Games >= min_games && s >= 0.5 - balance && s <= 0.5 + balance {
+				choices = append(choices, c.Move)
+			}
+		}
+		if len(choices) == 0 {
+			break
+		}
+		mv := choices[rng.Intn(len(choices))]
+		moves = append(moves, mv)
+		b.MoveUpdate(mv)
+	}
+	return moves
+}
+
+type book_file struct {
+	Depth int
+	Positions map[string][]*Candidate
+}
+
+// Write saves the book as JSON.
+func (bk *Book) Write(w io.Writer) error {
+	f := book_file{
+		Depth: bk.Depth,
+		Positions: make(map[string][]*Candidate, len(bk.positions)),
+	}
+	for key, moves := range bk.positions {
+		cands := make([]*Candidate, 0, len(moves))
+		for _, c := range moves {
+			cands = append(cands, c)
+		}
+		sort.Slice(cands, func(i, j int) bool { return cands[i].Move < cands[j].Move })
+		f.Positions[key] = cands
+	}
+	return json.NewEncoder(w).Encode(&f)
+}
+
+// ReadBook loads a book saved by Book.Write.
+func ReadBook(r io.Reader) (*Book, error) {
+	var f book_file
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	bk := NewBook(f.Depth)
+	for key, cands := range f.Positions {
+		moves := make(map[game.Position]*Candidate, len(cands))
+		for _, c := range cands {
+			moves[c.Move] = c
+		}
+		bk.positions[key] = moves
+	}
+	return bk, nil
+}
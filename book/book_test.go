@@ -0,0 +1,144 @@
+package book
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"game"
+)
+
+func random_game(rng *rand.Rand, boardlen int) []game.Position {
+	b := game.NewBoardSFEN(boardlen, game.MakeInitialSFEN(boardlen))
+	var moves []game.Position
+	for !b.IsGameOver() {
+		mv := game.Position(-1)
+		if lms := b.LegalMoves(); len(lms) != 0 {
+			mv = lms[rng.Intn(len(lms))]
+		}
+		moves = append(moves, mv)
+		b.MoveUpdate(mv)
+	}
+	return moves
+}
+
+func test_book(t *testing.T, n_games int) (*Book, [][]game.Position) {
+	rng := rand.New(rand.NewSource(1))
+	bk := NewBook(6)
+	start := game.NewBoardSFEN(6, game.MakeInitialSFEN(6))
+	var games [][]game.Position
+	for i := 0; i < n_games; i++ {
+		moves := random_game(rng, 6)
+		if err := bk.AddGame(start, moves); err != nil {
+			t.Fatal(err)
+		}
+		games = append(games, moves)
+	}
+	return bk, games
+}
+
+func TestLookup(t *testing.T) {
+	bk, games := test_book(t, 200)
+	start := game.NewBoardSFEN(6, game.MakeInitialSFEN(6))
+	total := 0
+	for _, c := range bk.Lookup(start) {
+		total += c.Games
+		if c.Wins + c.Draws + c.Losses != c.Games {
+			t.Errorf("%+v: results do not add up", c)
+		}
+	}
+	if total != len(games) {
+		t.Errorf("%d games from the start position, want %d", total, len(games))
+	}
+
+	// every position of the games is found in every orientation, with
+	// the move that was played, or one equivalent to it, among the
+	// candidates
+	for _, moves := range games[:20] {
+		b := start.Copy()
+		for _, mv := range moves[:bk.Depth] {
+			for sym := game.Symmetry(0); sym < game.NumSymmetries; sym++ {
+				b2 := b.Transform(sym)
+				mv2 := game.TransformPosition(6, mv, sym)
+				next, _ := b2.Move(mv2).Canonical()
+				found := false
+				for _, c := range bk.Lookup(b2) {
+					if !b2.IsLegalMove(c.Move) {
+						t.Fatalf("%s: illegal book move %d", b2.ToSFEN(), c.Move)
+					}
+					next2, _ := b2.Move(c.Move).Canonical()
+					found = found || next2.ToSFEN() == next.ToSFEN()
+				}
+				if !found {
+					t.Fatalf("%s: move %d not in book", b2.ToSFEN(), mv2)
+				}
+			}
+			b.MoveUpdate(mv)
+		}
+		if bk.Lookup(b) != nil && b.DiscNum() > 4 + bk.Depth {
+			t.Errorf("%s: position beyond the book depth", b.ToSFEN())
+		}
+	}
+
+	if err := bk.AddGame(start, games[0][:10]); err == nil {
+		t.Error("AddGame accepted an unfinished game")
+	}
+	if err := bk.AddGame(start, []game.Position{0}); err == nil {
+		t.Error("AddGame accepted an illegal move")
+	}
+}
+
+func TestBest(t *testing.T) {
+	bk, _ := test_book(t, 200)
+	start := game.NewBoardSFEN(6, game.MakeInitialSFEN(6))
+	best, ok := bk.Best(start, 10)
+	if !ok {
+		t.Fatal("no book move for the start position")
+	}
+	for _, c := range bk.Lookup(start) {
+		if c.Games >= 10 && c.Score() > best.Score() {
+			t.Errorf("Best = %+v, but %+v scores more", best, c)
+		}
+	}
+	if _, ok := bk.Best(start, 1000); ok {
+		t.Error("Best found a move played in 1000 games")
+	}
+}
+
+func TestRandomOpening(t *testing.T) {
+	bk, _ := test_book(t, 200)
+	rng := rand.New(rand.NewSource(2))
+	start := game.NewBoardSFEN(6, game.MakeInitialSFEN(6))
+	for i := 0; i < 20; i++ {
+		moves := bk.RandomOpening(start, 4, 2, 0.3, rng)
+		if len(moves) > 4 {
+			t.Fatalf("%d moves, want at most 4", len(moves))
+		}
+		b := start.Copy()
+		for _, mv := range moves {
+			if !b.IsLegalMove(mv) {
+				t.Fatalf("illegal opening move %d in %v", mv, moves)
+			}
+			b.MoveUpdate(mv)
+		}
+	}
+	if start.DiscNum() != 4 {
+		t.Error("RandomOpening modified the board")
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	bk, _ := test_book(t, 50)
+	var buf bytes.Buffer
+	if err := bk.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	bk2, err := ReadBook(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bk2.Depth != bk.Depth || !reflect.DeepEqual(bk.positions, bk2.positions) {
+		t.Error("book changed after writing and reading it back")
+	}
+}
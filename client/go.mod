@@ -4,4 +4,15 @@ go 1.18
 
 replace game => ../game
 
-require game v0.0.0-00010101000000-000000000000 // indirect
+replace engine => ../engine
+
+replace eval => ../eval
+
+replace book => ../book
+
+require (
+	book v0.0.0-00010101000000-000000000000
+	engine v0.0.0-00010101000000-000000000000
+	eval v0.0.0-00010101000000-000000000000
+	game v0.0.0-00010101000000-000000000000
+)
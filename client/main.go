@@ -4,22 +4,28 @@ import (
 	"encoding/json"
 	"bufio"
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"net"
+	"os"
+	"runtime"
 	"time"
 
+	"book"
+	"engine"
+	"eval"
 	"game"
 )
 
 type Login struct {
-	Message  string // LOGIN
+	Message  string // LOGIN, REGISTER
 	Userid   string
 	Password string
 }
 
 type Message struct {
-	Message string // READY, a6,A6, pass,PASS, LOGOUT
+	Message string // READY, a6,A6, pass,PASS, LOGOUT, RESIGN, OFFERDRAW, ACCEPTDRAW, DECLINEDRAW
 }
 
 type GameState int
@@ -36,8 +42,23 @@ type GameMessage struct {
 	Position    string
 	Moves       []string
 	BoardSize   int
-	Timeout     int
+	Timeout     int // msec for this move
+	Clock       string // move, fischer or byoyomi
+	BlackTime   int // msec left in the time banks
+	WhiteTime   int
+	Increment   int
+	Byoyomi     int
 	State       string
+	Pair        *PairResult
+}
+
+type PairResult struct {
+	Pairid      string
+	Game        int
+	First       string
+	Second      string
+	FirstScore  float64
+	SecondScore float64
 }
 
 type Game struct {
@@ -48,20 +69,39 @@ type Game struct {
 	White      string
 	Moves      []string
 	Timeout    int
+	Clock      *engine.Clock // nil when the server only has a per-move timeout
 	Board      *game.Board //pointer to Board
 }
 
-func send_login_msg(conn net.Conn, userid string, password string) error {
+// send_login_msg logs in, or with register creates the account first
+func send_login_msg(conn net.Conn, userid string, password string, register bool) error {
 	l := Login{
 		Message: "LOGIN",
 		Userid: userid,
 		Password: password,
 	}
+	if register {
+		l.Message = "REGISTER"
+	}
 	b := str2json(l)
 	conn.Write(b)
 	return nil
 }
 
+// relogin connects and logs in again until it succeeds or deadline passes.
+func relogin(addr string, userid string, password string, deadline time.Time) (net.Conn, error) {
+	for {
+		conn, err := net.Dial("tcp", addr)
+		if err == nil {
+			return conn, send_login_msg(conn, userid, password, false)
+		}
+		if time.Now().After(deadline) {
+			return nil, err
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
 func send_msg(conn net.Conn, msg string) error {
 	r := Message{Message: msg}
 	b := str2json(r)
@@ -91,15 +131,20 @@ func json2msg(b []byte) Message {
 	return m
 }
 
-func mk_game(gm *GameMessage) *Game {
+func mk_game(gm *GameMessage) (*Game, error) {
 	sfen := gm.Position
 	turn := 0 // black
 	if gm.Turn == "white" {
 		turn = 1
 	}
 	boardlen := gm.BoardSize
-	b := game.NewBoardSFEN(boardlen, sfen)
-	b.Turn = turn
+	b, err := game.ParseSFEN(boardlen, sfen)
+	if err != nil {
+		return nil, err
+	}
+	if b.Turn != turn {
+		return nil, fmt.Errorf("turn %q does not match position %q", gm.Turn, sfen)
+	}
 	
 	g := Game{
 		Gameid: gm.Gameid,
@@ -111,14 +156,28 @@ func mk_game(gm *GameMessage) *Game {
 		Timeout: gm.Timeout,
 		Board: b,
 	}
-	return &g
+	if gm.Clock == "fischer" || gm.Clock == "byoyomi" {
+		remaining := gm.BlackTime
+		if turn == 1 {
+			remaining = gm.WhiteTime
+		}
+		g.Clock = &engine.Clock{
+			Remaining: time.Duration(remaining) * time.Millisecond,
+			Increment: time.Duration(gm.Increment) * time.Millisecond,
+			Byoyomi: time.Duration(gm.Byoyomi) * time.Millisecond,
+			Margin: clock_margin,
+		}
+	}
+	return &g, nil
 }
 
-func json2game(b []byte) *Game {
+func json2game(b []byte) (*Game, error) {
 	var gm GameMessage
-	json.Unmarshal(b, &gm)
-	g := mk_game(&gm)
-	return g
+	err := json.Unmarshal(b, &gm)
+	if err != nil {
+		return nil, err
+	}
+	return mk_game(&gm)
 }
 
 func json2gm(b []byte) *GameMessage {
@@ -127,27 +186,104 @@ func json2gm(b []byte) *GameMessage {
 	return &gm
 }
 
+// time kept back from the clock for the network and the server
+const clock_margin = 100 * time.Millisecond
+
+// move_budget is the thinking time for a move: managed by the clock when
+// the server has one, otherwise move_time kept well inside the per-move
+// timeout
+func move_budget(g *Game, move_time_msec int) time.Duration {
+	if g.Clock != nil {
+		return g.Clock.MoveTime(g.Board)
+	}
+	if g.Timeout > 0 && move_time_msec > g.Timeout/2 {
+		move_time_msec = g.Timeout/2
+	}
+	return time.Duration(move_time_msec) * time.Millisecond
+}
+
+func read_pattern(name string) (*eval.Pattern, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return eval.ReadPattern(bufio.NewReader(f))
+}
+
+func read_book(name string) (*book.Book, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return book.ReadBook(bufio.NewReader(f))
+}
+
 func main() {
 	rand.Seed(time.Now().UnixNano())
 	addr := flag.String("addr", "localhost:19714", "server IP address:port")
 	userid := flag.String("userid", "player1", "userid")
 	password := flag.String("password", "password", "password")
+	reconnect := flag.Int("reconnect", 0, "msec to keep logging in again after the connection is lost")
+	resign := flag.Bool("resign", false, "alphabeta resigns when the endgame solver proves the game lost")
+	accept_draws := flag.Bool("accept_draws", false, "accept draw offers")
+	register := flag.Bool("register", false, "register userid with password before logging in")
 	sleep := flag.Bool("sleep", false, "sleeps for 11000msec")
+	player := flag.String("player", "random", "move selection: random, alphabeta or mcts")
+	move_time := flag.Int("move_time", 1000, "search time per move (msec) when the server has no clock")
+	solve_empties := flag.Int("solve_empties", 14, "alphabeta solves the endgame exactly from this many empty squares")
+	playouts := flag.Int("playouts", 0, "mcts playouts per move, 0 for as many as move_time allows")
+	exploration := flag.Float64("exploration", engine.DefaultExploration, "mcts UCT exploration constant")
+	threads := flag.Int("threads", runtime.NumCPU(), "mcts search goroutines")
+	pattern := flag.String("pattern", "", "alphabeta evaluates 8x8 boards with these pattern weights (see trainer)")
+	book_file := flag.String("book", "", "alphabeta plays from this opening book (see mkbook)")
+	book_games := flag.Int("book_games", 5, "alphabeta plays book moves played in at least this many games")
 	flag.Parse()
 
+	var searcher *engine.Searcher
+	var solver *engine.Solver
+	switch *player {
+	case "random":
+	case "alphabeta":
+		searcher = engine.NewSearcher(engine.DefaultTTBits)
+		solver = engine.NewSolver(engine.DefaultTTBits)
+		if *pattern != "" {
+			p, err := read_pattern(*pattern)
+			if err != nil {
+				log.Println("pattern weights err =", err)
+				return
+			}
+			searcher.SetEvaluator(p)
+		}
+		if *book_file != "" {
+			bk, err := read_book(*book_file)
+			if err != nil {
+				log.Println("opening book err =", err)
+				return
+			}
+			searcher.SetBook(bk, *book_games)
+		}
+	case "mcts":
+	default:
+		log.Println("unknown player =", *player)
+		return
+	}
+
 	conn, err := net.Dial("tcp", *addr)
 	if err != nil {
 		log.Println("Dial error ln =", conn, " err =", err)
 		return
 	}
 
-	err = send_login_msg(conn, *userid, *password)
+	err = send_login_msg(conn, *userid, *password, *register)
 	if err != nil {
 		log.Println("Login failed err =", err)
 		return
 	}
 
 	bio := bufio.NewReader(conn)
+	reconnect_deadline := time.Time{} // while logging in again
 
 	var g *Game
 	for {
@@ -161,22 +297,90 @@ func main() {
 		// log.Println("received msg = ", string(b))
 		if err != nil {
 			log.Println("wait_msg err =", err)
-			break
+			conn.Close()
+			if *reconnect <= 0 {
+				break
+			}
+			// log in again to resume the game
+			if reconnect_deadline.IsZero() {
+				reconnect_deadline = time.Now().Add(time.Duration(*reconnect) * time.Millisecond)
+			} else {
+				// the login again was refused, wait before the next one
+				time.Sleep(time.Second)
+			}
+			if time.Now().After(reconnect_deadline) {
+				return
+			}
+			conn, err = relogin(*addr, *userid, *password, reconnect_deadline)
+			if err != nil {
+				log.Println("reconnect failed err =", err)
+				return
+			}
+			bio = bufio.NewReader(conn)
+			continue
+		}
+		if msg_type(b) != "LOGOUT" {
+			reconnect_deadline = time.Time{}
 		}
 		switch msg_type(b) {
 		case "PLAY":
-			g = json2game(b)
+			g, err = json2game(b)
+			if err != nil {
+				log.Println("broken PLAY message err =", err)
+				conn.Close()
+				return
+			}
 			//g.Board.printBoard()
 			var move string
 			lms := g.Board.LegalMoves()
 			if len(lms) == 0 {
 				move = "pass"
+			} else if searcher != nil {
+				budget := move_budget(g, *move_time)
+				b := g.Board
+				start := time.Now()
+				pos, score, solved := game.Position(-1), 0, false
+				if b.Boardlen*b.Boardlen - b.DiscNum() <= *solve_empties {
+					// leave the search half of the budget if the solver gives up
+					pos,score,err = solver.Solve(b, budget/2)
+					solved = err == nil
+				}
+				if !solved {
+					pos,_,_ = searcher.Search(b, engine.Limits{Time: budget - time.Since(start)})
+				}
+				move = b.Position2Str(pos)
+				if solved && score < 0 && *resign {
+					move = "RESIGN"
+				}
+			} else if *player == "mcts" {
+				opt := engine.MCTSOptions{
+					Playouts: *playouts,
+					Exploration: *exploration,
+					Threads: *threads,
+					Seed: rand.Int63(),
+				}
+				if *playouts == 0 {
+					opt.Time = move_budget(g, *move_time)
+				}
+				pos,_,_ := engine.MCTS(g.Board, opt)
+				move = g.Board.Position2Str(pos)
 			} else {
 				pos := lms[rand.Int() % len(lms)]
 				move = g.Board.Position2Str(pos)
 			}
 			send_msg(conn, move)
 
+		case "OFFERDRAW":
+			if *accept_draws {
+				send_msg(conn, "ACCEPTDRAW")
+			} else {
+				send_msg(conn, "DECLINEDRAW")
+			}
+
+		case "DECLINEDRAW":
+			// only answers an OFFERDRAW sent instead of a move, and the
+			// move is then still due; this client never offers draws
+
 		case "ISREADY":
 			err = send_msg(conn, "READY")
 			if err != nil {
@@ -189,9 +393,13 @@ func main() {
 			gm := json2gm(b)
 			st := time.Unix(gm.StartTime,0)
 			et := time.Unix(gm.EndTime,0)
-			log.Printf("gameid=%s StartTime=%s EndTime=%s Black=%s/%s White=%s/%s boardsize=%d Result=%s Moves=%v\n",
+			log.Printf("gameid=%s StartTime=%s EndTime=%s Black=%s/%s White=%s/%s boardsize=%d Result=%s Position=%s Moves=%v\n",
 				gm.Gameid, st, et, gm.Black, gm.BlackRating, gm.White, gm.WhiteRating,
-				gm.BoardSize, gm.State, gm.Moves)
+				gm.BoardSize, gm.State, gm.Position, gm.Moves)
+			if p := gm.Pair; p != nil {
+				log.Printf("pairid=%s game %d of 2: %s %.1f - %.1f %s\n",
+					p.Pairid, p.Game, p.First, p.FirstScore, p.SecondScore, p.Second)
+			}
 			send_msg(conn, "RESULTOK")
 
 		default:
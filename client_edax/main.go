@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"bufio"
 	"flag"
+	"fmt"
 	"log"
 	"math/rand"
 	"net"
@@ -51,10 +52,82 @@ func NewEdax(edax_bin string, move_time int) (*Edax,error) {
 func (e *Edax) move(mv string) {
 	// nboard protocol
 	//msg := "move " + mv + "\n"
-	msg := "play " + e.op_color + " " + mv + "\n"
+	e.play(e.op_color, mv)
+}
+
+func (e *Edax) play(color string, mv string) {
+	msg := "play " + color + " " + mv + "\n"
 	io.WriteString(e.cin, msg)
 }
 
+// start_game sets up edax for a new game, playing the opening moves of gm,
+// and for a resumed game the moves played so far. edax starts from the
+// initial position, so other start positions cannot be played.
+func (e *Edax) start_game(gm *GameMessage, userid string) error {
+	e.clear_board()
+	if gm.Black == userid {
+		e.my_color = "black"
+		e.op_color = "white"
+	} else {
+		e.my_color = "white"
+		e.op_color = "black"
+	}
+	b := game.NewBoardSFEN(gm.BoardSize, game.MakeInitialSFEN(gm.BoardSize))
+	if gm.StartPosition != "" {
+		start, err := game.ParseSFEN(gm.BoardSize, gm.StartPosition)
+		if err != nil {
+			return err
+		}
+		if start.ToSFEN() != b.ToSFEN() {
+			return fmt.Errorf("cannot start from position %q", gm.StartPosition)
+		}
+	}
+	moves := gm.StartMoves
+	if gm.Resume {
+		moves = append(append([]string{}, moves...), gm.Moves...)
+	}
+	for _, s := range moves {
+		mv, err := b.Str2Position(s)
+		if err != nil {
+			return err
+		}
+		e.play([]string{"black", "white"}[b.Turn], s)
+		b.MoveUpdate(mv)
+	}
+	if gm.Clock == "fischer" || gm.Clock == "byoyomi" {
+		main_time := gm.BlackTime
+		if e.my_color == "white" {
+			main_time = gm.WhiteTime
+		}
+		byoyomi_stones := 0
+		if gm.Byoyomi > 0 {
+			byoyomi_stones = 1
+		}
+		fmt.Fprintf(e.cin, "time_settings %d %d %d\n", main_time/1000, gm.Byoyomi/1000, byoyomi_stones)
+	}
+	return nil
+}
+
+// time_left tells edax its time on the server clock with the GTP
+// time_settings and time_left commands.
+func (e *Edax) time_left(gm *GameMessage) {
+	if gm.Clock != "fischer" && gm.Clock != "byoyomi" {
+		return
+	}
+	remaining := gm.BlackTime
+	if e.my_color == "white" {
+		remaining = gm.WhiteTime
+	}
+	// GTP has no increment; it is counted as part of the bank
+	remaining += gm.Increment
+	if remaining == 0 {
+		// in byo-yomi: one move in the period
+		fmt.Fprintf(e.cin, "time_left %s %d 1\n", e.my_color, gm.Byoyomi/1000)
+	} else {
+		fmt.Fprintf(e.cin, "time_left %s %d 0\n", e.my_color, remaining/1000)
+	}
+}
+
 func (e *Edax) do_go() {
 	msg := "genmove " + e.my_color + "\n"
 	io.WriteString(e.cin, msg)
@@ -79,13 +152,13 @@ func (e *Edax) clear_board() {
 }
 
 type Login struct {
-	Message  string // LOGIN
+	Message  string // LOGIN, REGISTER
 	Userid   string
 	Password string
 }
 
 type Message struct {
-	Message string // READY, a6,A6, pass,PASS, LOGOUT
+	Message string // READY, a6,A6, pass,PASS, LOGOUT, RESIGN, DECLINEDRAW
 }
 
 type GameState int
@@ -100,9 +173,17 @@ type GameMessage struct {
 	WhiteRating string
 	Turn        string
 	Position    string
+	StartPosition string
+	StartMoves  []string
 	Moves       []string
+	Resume      bool // Moves has all the moves of the game
 	BoardSize   int
 	Timeout     int
+	Clock       string
+	BlackTime   int
+	WhiteTime   int
+	Increment   int
+	Byoyomi     int
 	State       string
 }
 
@@ -112,12 +193,16 @@ type Game struct {
 	Boardlen   int
 }
 
-func send_login_msg(conn net.Conn, userid string, password string) error {
+// send_login_msg logs in, or with register creates the account first
+func send_login_msg(conn net.Conn, userid string, password string, register bool) error {
 	l := Login{
 		Message: "LOGIN",
 		Userid: userid,
 		Password: password,
 	}
+	if register {
+		l.Message = "REGISTER"
+	}
 	b := str2json(l)
 	conn.Write(b)
 	return nil
@@ -152,29 +237,36 @@ func json2msg(b []byte) Message {
 	return m
 }
 
-func mk_game(gm *GameMessage) *Game {
+func mk_game(gm *GameMessage) (*Game, error) {
 	sfen := gm.Position
 	turn := 0 // black
 	if gm.Turn == "white" {
 		turn = 1
 	}
 	boardlen := gm.BoardSize
-	b := game.NewBoardSFEN(boardlen, sfen)
-	b.Turn = turn
+	b, err := game.ParseSFEN(boardlen, sfen)
+	if err != nil {
+		return nil, err
+	}
+	if b.Turn != turn {
+		return nil, fmt.Errorf("turn %q does not match position %q", gm.Turn, sfen)
+	}
 	
 	g := Game{
 		Timeout: gm.Timeout,
 		Board: b,
 		Boardlen: boardlen,
 	}
-	return &g
+	return &g, nil
 }
 
-func json2game(b []byte) *Game {
+func json2game(b []byte) (*Game, error) {
 	var gm GameMessage
-	json.Unmarshal(b, &gm)
-	g := mk_game(&gm)
-	return g
+	err := json.Unmarshal(b, &gm)
+	if err != nil {
+		return nil, err
+	}
+	return mk_game(&gm)
 }
 
 func json2gm(b []byte) *GameMessage {
@@ -188,8 +280,9 @@ func main() {
 	addr := flag.String("addr", "localhost:19714", "server IP address:port")
 	userid := flag.String("userid", "player1", "userid")
 	password := flag.String("password", "password", "password")
+	register := flag.Bool("register", false, "register userid with password before logging in")
 	edax_bin := flag.String("edax", "./edax", "path to edax binary")
-	move_time := flag.Int("move_time", 55, "edax move-time option (sec)")
+	move_time := flag.Int("move_time", 55, "edax move-time option (sec), edax is told the time left when the server has a clock")
 	flag.Parse()
 
 	conn, err := net.Dial("tcp", *addr)
@@ -198,7 +291,7 @@ func main() {
 		return
 	}
 
-	err = send_login_msg(conn, *userid, *password)
+	err = send_login_msg(conn, *userid, *password, *register)
 	if err != nil {
 		log.Println("Login failed err =", err)
 		return
@@ -211,6 +304,7 @@ func main() {
 		log.Println("Edax binary not found: err =", err)
 		return
 	}
+	gameid := ""
 	for {
 		b,err := wait_msg(bio)
 		if err != nil {
@@ -220,30 +314,36 @@ func main() {
 		switch msg_type(b) {
 		case "PLAY":
 			gm := json2gm(b)
-			if e.my_color == "" {
-				if gm.Black == *userid {
-					e.my_color = "black"
-					e.op_color = "white"
-					
-				} else {
-					e.my_color = "white"
-					e.op_color = "black"
+			if gm.Gameid != gameid || gm.Resume {
+				// paired games follow each other without ISREADY
+				gameid = gm.Gameid
+				err = e.start_game(gm, *userid)
+				if err != nil {
+					// edax would play on from the wrong position
+					log.Println("game setup failed err =", err)
+					send_msg(conn, "RESIGN")
+					continue
 				}
 			}
 
 			n_moves := len(gm.Moves)
 			var move string
-			if n_moves == 0 {
+			if n_moves == 0 || gm.Resume {
+				e.time_left(gm)
 				e.do_go()
 				move = e.get_next_move()
 			} else {
 				last_mv := gm.Moves[n_moves-1]
 				e.move(last_mv)
+				e.time_left(gm)
 				e.do_go()
 				move = e.get_next_move()
 			}
 			send_msg(conn, move)
 
+		case "OFFERDRAW":
+			send_msg(conn, "DECLINEDRAW")
+
 		case "ISREADY":
 			e.clear_board()
 
@@ -258,9 +358,9 @@ func main() {
 			gm := json2gm(b)
 			st := time.Unix(gm.StartTime,0)
 			et := time.Unix(gm.EndTime,0)
-			log.Printf("gameid=%s StartTime=%s EndTime=%s Black=%s/%s White=%s/%s boardsize=%d Result=%s Moves=%v\n",
+			log.Printf("gameid=%s StartTime=%s EndTime=%s Black=%s/%s White=%s/%s boardsize=%d Result=%s Position=%s Moves=%v\n",
 				gm.Gameid, st, et, gm.Black, gm.BlackRating, gm.White, gm.WhiteRating,
-				gm.BoardSize, gm.State, gm.Moves)
+				gm.BoardSize, gm.State, gm.Position, gm.Moves)
 			send_msg(conn, "RESULTOK")
 
 		default:
@@ -0,0 +1,33 @@
+package engine
+
+import (
+	"time"
+
+	"game"
+)
+
+// Clock is the time a player has for the rest of a game.
+type Clock struct {
+	Remaining time.Duration // time bank
+	Increment time.Duration // added to the bank after every move
+	Byoyomi time.Duration // allowed for each move once the bank is spent
+	Margin time.Duration // kept back for network delays
+}
+
+// MoveTime returns how long to think on the move of b: the bank spread
+// evenly over the moves the side to move has left, plus the increment and
+// the byo-yomi, but well inside the time the clock allows.
+func (c Clock) MoveTime(b *game.Board) time.Duration {
+	empties := b.Boardlen*b.Boardlen - b.DiscNum()
+	// one move more than are left, to keep a reserve for passes
+	moves := (empties+1)/2 + 1
+	t := c.Remaining/time.Duration(moves) + c.Increment + c.Byoyomi
+	hard := c.Remaining + c.Byoyomi
+	if max := hard - hard/10 - c.Margin; t > max {
+		t = max
+	}
+	if t < 0 {
+		t = 0
+	}
+	return t
+}
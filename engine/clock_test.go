@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"game"
+)
+
+func TestClockMoveTime(t *testing.T) {
+	b := game.NewBoardSFEN(8, game.MakeInitialSFEN(8))
+	for _, c := range []Clock{
+		{Remaining: time.Minute},
+		{Remaining: time.Minute, Increment: time.Second},
+		{Remaining: time.Second, Increment: 5*time.Second},
+		{Byoyomi: 10*time.Second, Margin: 100*time.Millisecond},
+		{Remaining: time.Minute, Byoyomi: 10*time.Second},
+		{Remaining: 50*time.Millisecond, Margin: 100*time.Millisecond},
+	} {
+		d := c.MoveTime(b)
+		// 90% of what the clock allows, less the margin
+		hard := c.Remaining + c.Byoyomi
+		max := hard - hard/10 - c.Margin
+		if max < 0 {
+			max = 0
+		}
+		if d < 0 || d > max {
+			t.Errorf("%+v: %v for a move, at most %v", c, d, max)
+		}
+		if c.Increment == 0 && c.Byoyomi == 0 && d > c.Remaining/30 {
+			t.Errorf("%+v: %v for the first of 30 moves", c, d)
+		}
+	}
+
+	// an increment larger than the bank is capped
+	c := Clock{Remaining: time.Second, Increment: 5*time.Second}
+	if d := c.MoveTime(b); d != 900*time.Millisecond {
+		t.Errorf("%+v: %v for a move, want 900ms", c, d)
+	}
+
+	// the bank is used up by the end of the game
+	c = Clock{Remaining: time.Minute}
+	b = random_position(rand.New(rand.NewSource(1)), 8, 58)
+	if d := c.MoveTime(b); d < 10*time.Second {
+		t.Errorf("%v with %d empties and a minute left", d, 64 - b.DiscNum())
+	}
+}
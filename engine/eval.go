@@ -0,0 +1,14 @@
+package engine
+
+import (
+	"game"
+)
+
+// final_score is the exact score of a finished game for the side to move.
+func final_score(b *game.Board) int {
+	diff := b.CountBlack() - b.CountWhite()
+	if b.Turn == game.White {
+		diff = -diff
+	}
+	return diff * DiscScore
+}
@@ -0,0 +1,15 @@
+module engine
+
+go 1.18
+
+replace game => ../game
+
+replace eval => ../eval
+
+replace book => ../book
+
+require (
+	book v0.0.0-00010101000000-000000000000
+	eval v0.0.0-00010101000000-000000000000
+	game v0.0.0-00010101000000-000000000000
+)
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"game"
+)
+
+const (
+	DefaultPlayouts = 10000 // playouts run when MCTSOptions has neither Playouts nor Time
+	DefaultExploration = math.Sqrt2
+)
+
+// MCTSOptions configure a Monte Carlo tree search. Zero fields take their
+// defaults.
+type MCTSOptions struct {
+	Playouts int // total number of playouts
+	Time time.Duration
+	Exploration float64 // UCT exploration constant
+	Threads int // goroutines growing the shared tree
+	Seed int64 // seed of the random playouts
+}
+
+type mcts_node struct {
+	mu sync.Mutex
+	move game.Position // move leading to this node, -1 for a pass
+	player int // color that played move
+	children []*mcts_node
+	untried []game.Position
+	visits int // includes the virtual losses of playouts in progress
+	wins float64 // for player, a draw counts half
+}
+
+func new_mcts_node(b *game.Board, move game.Position, player int) *mcts_node {
+	n := &mcts_node{
+		move: move,
+		player: player,
+		untried: b.LegalMoves(),
+	}
+	if len(n.untried) == 0 && !b.IsGameOver() {
+		n.untried = []game.Position{-1}
+	}
+	return n
+}
+
+// MCTS runs a UCT search and returns the most visited move (-1 to pass),
+// its winning rate for the side to move, and the number of playouts. With
+// several threads the goroutines share one tree and use virtual losses to
+// spread out. b is not modified.
+func MCTS(b *game.Board, opt MCTSOptions) (game.Position, float64, int) {
+	if opt.Playouts == 0 && opt.Time == 0 {
+		opt.Playouts = DefaultPlayouts
+	}
+	if opt.Exploration == 0 {
+		opt.Exploration = DefaultExploration
+	}
+	if opt.Threads < 1 {
+		opt.Threads = 1
+	}
+	var deadline time.Time
+	if opt.Time > 0 {
+		deadline = time.Now().Add(opt.Time)
+	}
+
+	root := new_mcts_node(b, -1, 1 - b.Turn)
+	var playouts int64
+	var wg sync.WaitGroup
+	for i := 0; i < opt.Threads; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for {
+				n := atomic.AddInt64(&playouts, 1)
+				if opt.Playouts > 0 && n > int64(opt.Playouts) {
+					atomic.AddInt64(&playouts, -1)
+					return
+				}
+				if !deadline.IsZero() && time.Now().After(deadline) {
+					return
+				}
+				mcts_iteration(root, b.Copy(), opt.Exploration, rng)
+			}
+		}(opt.Seed + int64(i))
+	}
+	wg.Wait()
+
+	var best *mcts_node
+	for _, c := range root.children {
+		if best == nil || c.visits > best.visits {
+			best = c
+		}
+	}
+	if best == nil {
+		return -1, 0, int(playouts)
+	}
+	return best.move, best.wins / float64(best.visits), int(playouts)
+}
+
+// mcts_iteration does one selection, expansion, playout and backup.
+func mcts_iteration(root *mcts_node, b *game.Board, c float64, rng *rand.Rand) {
+	path := []*mcts_node{root}
+	node := root
+	node.mu.Lock()
+	node.visits++
+	for {
+		if len(node.untried) != 0 {
+			// expand one untried move
+			i := rng.Intn(len(node.untried))
+			mv := node.untried[i]
+			node.untried[i] = node.untried[len(node.untried)-1]
+			node.untried = node.untried[:len(node.untried)-1]
+			player := b.Turn
+			b.MoveUpdate(mv)
+			child := new_mcts_node(b, mv, player)
+			child.visits = 1
+			node.children = append(node.children, child)
+			node.mu.Unlock()
+			path = append(path, child)
+			break
+		}
+		if len(node.children) == 0 {
+			// finished game
+			node.mu.Unlock()
+			break
+		}
+		child := uct_select(node, c)
+		node.mu.Unlock()
+		child.mu.Lock()
+		// virtual loss until the result is backed up
+		child.visits++
+		b.MoveUpdate(child.move)
+		path = append(path, child)
+		node = child
+	}
+
+	for !b.IsGameOver() {
+		mv := game.Position(-1)
+		if lms := b.LegalMoves(); len(lms) != 0 {
+			mv = lms[rng.Intn(len(lms))]
+		}
+		b.MoveUpdate(mv)
+	}
+	diff := b.CountBlack() - b.CountWhite()
+	for _, n := range path {
+		w := 0.5
+		if diff > 0 && n.player == game.Black || diff < 0 && n.player == game.White {
+			w = 1
+		} else if diff != 0 {
+			w = 0
+		}
+		n.mu.Lock()
+		n.wins += w
+		n.mu.Unlock()
+	}
+}
+
+// uct_select picks the child maximizing the UCT value. node is locked;
+// locks are always taken parent before child.
+func uct_select(node *mcts_node, c float64) *mcts_node {
+	log_n := math.Log(float64(node.visits))
+	var best *mcts_node
+	best_value := math.Inf(-1)
+	for _, ch := range node.children {
+		ch.mu.Lock()
+		visits, wins := float64(ch.visits), ch.wins
+		ch.mu.Unlock()
+		value := wins/visits + c*math.Sqrt(log_n/visits)
+		if value > best_value {
+			best_value = value
+			best = ch
+		}
+	}
+	return best
+}
@@ -0,0 +1,275 @@
+// Package engine is a game tree search for game.Board of any size:
+// iterative deepening negamax with alpha-beta pruning, a transposition
+// table, history and square based move ordering, and a time budget.
+package engine
+
+import (
+	"time"
+
+	"book"
+	"eval"
+	"game"
+)
+
+const (
+	DiscScore = eval.DiscScore // score of a one-disc lead; final scores are exact multiples
+	DefaultDepth = 6 // depth searched when Limits has neither Depth nor Time
+	DefaultTTBits = 20
+
+	infinity = 1 << 30
+)
+
+// Limits bound a search. Zero fields are unlimited, but at least one of
+// Depth and Time should be set.
+type Limits struct {
+	Depth int
+	Time time.Duration
+}
+
+// Searcher keeps the transposition table and move ordering statistics
+// between searches, so a bot should use one Searcher for a whole game.
+// A Searcher must not be used from several goroutines at once.
+type Searcher struct {
+	tt *TranspositionTable
+	evaluator eval.Evaluator // nil for eval.ForBoard
+	ev eval.Evaluator // in use by the current search
+	book *book.Book
+	book_min_games int
+	b *game.Board
+	history []int
+	pv [][]game.Position
+	keys [][]int
+	nodes int64
+	deadline time.Time
+	stop bool
+}
+
+func NewSearcher(tt_bits int) *Searcher {
+	return &Searcher{
+		tt: NewTranspositionTable(tt_bits),
+	}
+}
+
+// SetEvaluator makes the searcher score positions with e, or with
+// eval.ForBoard of the board size if e is nil.
+func (s *Searcher) SetEvaluator(e eval.Evaluator) {
+	s.evaluator = e
+}
+
+// SetBook makes Search play the best scoring move of bk that was played in
+// at least min_games games, when there is one. A nil bk turns the book off.
+func (s *Searcher) SetBook(bk *book.Book, min_games int) {
+	s.book = bk
+	s.book_min_games = min_games
+}
+
+// Search is a one-shot search with a fresh Searcher.
+func Search(b *game.Board, limits Limits) (game.Position, int, []game.Position) {
+	return NewSearcher(DefaultTTBits).Search(b, limits)
+}
+
+// Nodes returns the number of nodes visited by the last search.
+func (s *Searcher) Nodes() int64 {
+	return s.nodes
+}
+
+// Search returns the best move for the side to move in b (-1 to pass), its
+// score from that side's point of view in units of DiscScore, and the
+// principal variation starting with the move. A book move is scored by its
+// mean final disc difference. b is not modified.
+func (s *Searcher) Search(b *game.Board, limits Limits) (game.Position, int, []game.Position) {
+	s.nodes = 0
+	if s.book != nil {
+		if c, ok := s.book.Best(b, s.book_min_games); ok {
+			return c.Move, int(c.MeanDiscs() * DiscScore), []game.Position{c.Move}
+		}
+	}
+	start := time.Now()
+	s.b = b.Copy()
+	s.ev = s.evaluator
+	if s.ev == nil {
+		s.ev = eval.ForBoard(b.Boardlen)
+	}
+	s.stop = false
+	s.deadline = time.Time{}
+	if limits.Time > 0 {
+		s.deadline = start.Add(limits.Time)
+	}
+	n := b.Boardlen*b.Boardlen
+	if len(s.history) != n {
+		s.history = make([]int, n, n)
+	}
+	for i := range s.history {
+		s.history[i] /= 2
+	}
+
+	empties := n - b.DiscNum()
+	max_depth := limits.Depth
+	if max_depth == 0 && limits.Time == 0 {
+		max_depth = DefaultDepth
+	}
+	if max_depth == 0 || max_depth > empties {
+		max_depth = empties
+	}
+	if max_depth < 1 {
+		max_depth = 1
+	}
+
+	best_move := game.Position(-1)
+	if lms := s.b.LegalMoves(); len(lms) != 0 {
+		best_move = lms[0]
+	}
+	best_score := 0
+	var best_pv []game.Position
+	for depth := 1; depth <= max_depth; depth++ {
+		score := s.negamax(depth, 0, -infinity, infinity)
+		if s.stop {
+			break
+		}
+		best_score = score
+		best_pv = append([]game.Position{}, s.pv[0]...)
+		if len(best_pv) != 0 {
+			best_move = best_pv[0]
+		}
+		// the next iteration takes several times longer than this one
+		if limits.Time > 0 && time.Since(start) > limits.Time/2 {
+			break
+		}
+	}
+	return best_move, best_score, best_pv
+}
+
+func (s *Searcher) negamax(depth int, ply int, alpha int, beta int) int {
+	s.nodes++
+	if s.nodes & 1023 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.stop = true
+	}
+	if s.stop {
+		return 0
+	}
+	s.pv_clear(ply)
+	b := s.b
+
+	lms := b.LegalMoves()
+	if len(lms) == 0 {
+		if b.IsGameOver() {
+			return final_score(b)
+		}
+		// a pass does not use up depth; two passes in a row end the game
+		u := b.MoveUpdate(-1)
+		score := -s.negamax(depth, ply+1, -beta, -alpha)
+		b.Undo(u)
+		s.pv_set(ply, -1)
+		return score
+	}
+	if depth == 0 {
+		return s.ev.Evaluate(b)
+	}
+
+	alpha_orig := alpha
+	key := b.Hash()
+	tt_move := game.Position(-1)
+	if e := s.tt.probe(key); e != nil {
+		tt_move = game.Position(e.move)
+		if ply > 0 && int(e.depth) >= depth {
+			score := int(e.score)
+			switch e.flag {
+			case tt_exact:
+				s.pv[ply] = append(s.pv[ply], tt_move)
+				return score
+			case tt_lower:
+				if score > alpha {
+					alpha = score
+				}
+			case tt_upper:
+				if score < beta {
+					beta = score
+				}
+			}
+			if alpha >= beta {
+				return score
+			}
+		}
+	}
+
+	s.order_moves(lms, tt_move, ply)
+	best := -infinity
+	best_move := lms[0]
+	for _, mv := range lms {
+		u := b.MoveUpdate(mv)
+		score := -s.negamax(depth-1, ply+1, -beta, -alpha)
+		b.Undo(u)
+		if s.stop {
+			return 0
+		}
+		if score > best {
+			best = score
+			best_move = mv
+			if score > alpha {
+				alpha = score
+				s.pv_set(ply, mv)
+			}
+		}
+		if alpha >= beta {
+			s.history[mv] += depth*depth
+			break
+		}
+	}
+
+	flag := tt_exact
+	if best <= alpha_orig {
+		flag = tt_upper
+	} else if best >= beta {
+		flag = tt_lower
+	}
+	s.tt.store(key, depth, best, flag, best_move)
+	return best
+}
+
+// order_moves sorts lms best first: the transposition table move, then by
+// square class (corners first, X-squares last) and history.
+func (s *Searcher) order_moves(lms []game.Position, tt_move game.Position, ply int) {
+	for len(s.keys) <= ply {
+		s.keys = append(s.keys, nil)
+	}
+	keys := s.keys[ply][:0]
+	for _, mv := range lms {
+		key := s.history[mv]
+		if mv == tt_move {
+			key = infinity
+		} else {
+			class, _ := eval.SquareClass(s.b.Boardlen, mv)
+			key += order_bonus[class]
+		}
+		keys = append(keys, key)
+	}
+	s.keys[ply] = keys
+	// insertion sort, move lists are short
+	for i := 1; i < len(lms); i++ {
+		for j := i; j > 0 && keys[j] > keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+			lms[j], lms[j-1] = lms[j-1], lms[j]
+		}
+	}
+}
+
+var order_bonus = [...]int{
+	eval.Inner: 0,
+	eval.Edge: 1000,
+	eval.Corner: 1_000_000,
+	eval.XSquare: -1_000_000,
+	eval.CSquare: -1000,
+}
+
+func (s *Searcher) pv_clear(ply int) {
+	for len(s.pv) <= ply+1 {
+		s.pv = append(s.pv, nil)
+	}
+	s.pv[ply] = s.pv[ply][:0]
+}
+
+// pv_set makes mv followed by the line of ply+1 the line of ply.
+func (s *Searcher) pv_set(ply int, mv game.Position) {
+	s.pv[ply] = append(s.pv[ply][:0], mv)
+	s.pv[ply] = append(s.pv[ply], s.pv[ply+1]...)
+}
@@ -0,0 +1,241 @@
+package engine
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"book"
+	"eval"
+	"game"
+)
+
+// minimax is a plain fixed-depth search with the same conventions as
+// Searcher.negamax, to check that pruning and the transposition table do
+// not change the result.
+func minimax(b *game.Board, depth int) int {
+	lms := b.LegalMoves()
+	if len(lms) == 0 {
+		if b.IsGameOver() {
+			return final_score(b)
+		}
+		return -minimax(b.Move(-1), depth)
+	}
+	if depth == 0 {
+		return eval.ForBoard(b.Boardlen).Evaluate(b)
+	}
+	best := -infinity
+	for _, mv := range lms {
+		if score := -minimax(b.Move(mv), depth-1); score > best {
+			best = score
+		}
+	}
+	return best
+}
+
+func random_position(rng *rand.Rand, boardlen int, n_moves int) *game.Board {
+	b := game.NewBoardSFEN(boardlen, game.MakeInitialSFEN(boardlen))
+	for i := 0; i < n_moves && !b.IsGameOver(); i++ {
+		mv := game.Position(-1)
+		if lms := b.LegalMoves(); len(lms) != 0 {
+			mv = lms[rng.Intn(len(lms))]
+		}
+		b.MoveUpdate(mv)
+	}
+	return b
+}
+
+func TestSearchMatchesMinimax(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, boardlen := range []int{6, 8} {
+		for i := 0; i < 10; i++ {
+			b := random_position(rng, boardlen, rng.Intn(boardlen*boardlen))
+			if b.IsGameOver() {
+				continue
+			}
+			sfen := b.ToSFEN()
+			for depth := 1; depth <= 4; depth++ {
+				want := minimax(b, depth)
+				mv, score, pv := Search(b, Limits{Depth: depth})
+				if score != want {
+					t.Fatalf("%s depth %d: score = %d, minimax = %d", sfen, depth, score, want)
+				}
+				if !b.IsLegalMove(mv) || len(pv) == 0 || pv[0] != mv {
+					t.Fatalf("%s depth %d: move %d, pv %v", sfen, depth, mv, pv)
+				}
+				if b.ToSFEN() != sfen {
+					t.Fatalf("Search modified the board: %s, want %s", b.ToSFEN(), sfen)
+				}
+			}
+		}
+	}
+}
+
+func TestSearchEndgame(t *testing.T) {
+	// with few empties the search reaches the end of the game and the
+	// score is the exact final disc difference
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 10; i++ {
+		b := random_position(rng, 6, 28)
+		_, score, _ := Search(b, Limits{})
+		want := minimax(b, 36)
+		if score != want || score % DiscScore != 0 {
+			t.Fatalf("%s: score = %d, want %d", b.ToSFEN(), score, want)
+		}
+	}
+}
+
+func TestSolve4x4(t *testing.T) {
+	// 4x4 reversi is a 3-11 win for white under perfect play
+	b := game.NewBoardSFEN(4, game.MakeInitialSFEN(4))
+	if _, score := Solve(b); score != -8 {
+		t.Errorf("Solve(4x4) = %d, want -8", score)
+	}
+}
+
+func TestSolveMatchesMinimax(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	s := NewSolver(16)
+	for _, tt := range []struct {
+		boardlen int
+		n_moves int
+	}{
+		{6, 24},
+		{8, 52},
+		{10, 90},
+	} {
+		for i := 0; i < 10; i++ {
+			b := random_position(rng, tt.boardlen, tt.n_moves)
+			empties := tt.boardlen*tt.boardlen - b.DiscNum()
+			want := minimax(b, empties) / DiscScore
+			mv, score, err := s.Solve(b, 0)
+			if err != nil || score != want {
+				t.Fatalf("%s: Solve = %d (%v), want %d", b.ToSFEN(), score, err, want)
+			}
+			if !b.IsLegalMove(mv) {
+				t.Fatalf("%s: Solve move %d is illegal", b.ToSFEN(), mv)
+			}
+			scores, _ := s.SolveMoves(b, 0)
+			best := -infinity
+			for _, ms := range scores {
+				if ms.Move == mv && ms.Score != score {
+					t.Fatalf("%s: SolveMoves gives %d for %d, Solve %d", b.ToSFEN(), ms.Score, mv, score)
+				}
+				if ms.Score > best {
+					best = ms.Score
+				}
+			}
+			if best != score {
+				t.Fatalf("%s: best of SolveMoves = %d, Solve = %d", b.ToSFEN(), best, score)
+			}
+		}
+	}
+}
+
+func TestSolveTimeout(t *testing.T) {
+	b := game.NewBoardSFEN(8, game.MakeInitialSFEN(8))
+	if _, _, err := NewSolver(16).Solve(b, time.Millisecond); err != ErrTimeout {
+		t.Errorf("Solve(8x8, 1ms) error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestMCTS(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for i := 0; i < 20; i++ {
+		b := random_position(rng, 6, rng.Intn(28))
+		if b.IsGameOver() {
+			continue
+		}
+		sfen := b.ToSFEN()
+		for _, threads := range []int{1, 4} {
+			mv, rate, playouts := MCTS(b, MCTSOptions{Playouts: 500, Threads: threads, Seed: int64(i)})
+			if playouts != 500 {
+				t.Errorf("%s: %d playouts, want 500", sfen, playouts)
+			}
+			if !b.IsLegalMove(mv) || mv == -1 && len(b.LegalMoves()) != 0 {
+				t.Errorf("%s: illegal move %d", sfen, mv)
+			}
+			if rate < 0 || rate > 1 {
+				t.Errorf("%s: winning rate %v", sfen, rate)
+			}
+		}
+		if b.ToSFEN() != sfen {
+			t.Fatalf("MCTS modified the board: %s, want %s", b.ToSFEN(), sfen)
+		}
+	}
+}
+
+// TestMCTSEndgame checks that with a few empties left MCTS finds a
+// winning move whenever there is one.
+func TestMCTSEndgame(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	for i := 0; i < 20; i++ {
+		b := random_position(rng, 6, 28)
+		if b.IsGameOver() || len(b.LegalMoves()) == 0 {
+			continue
+		}
+		scores, _ := NewSolver(16).SolveMoves(b, 0)
+		best := scores[0].Score
+		for _, s := range scores {
+			if s.Score > best {
+				best = s.Score
+			}
+		}
+		mv, _, _ := MCTS(b, MCTSOptions{Playouts: 5000, Seed: 1})
+		for _, s := range scores {
+			if s.Move == mv && best > 0 && s.Score <= 0 {
+				t.Errorf("%s: MCTS played %d scoring %d, best %d", b.ToSFEN(), mv, s.Score, best)
+			}
+		}
+	}
+}
+
+func TestMCTSTime(t *testing.T) {
+	b := game.NewBoardSFEN(8, game.MakeInitialSFEN(8))
+	start := time.Now()
+	MCTS(b, MCTSOptions{Time: 50*time.Millisecond, Threads: 2})
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("MCTS with 50ms took %v", d)
+	}
+}
+
+func TestSearchBook(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	start := game.NewBoardSFEN(6, game.MakeInitialSFEN(6))
+	bk := book.NewBook(book.DefaultDepth)
+	var moves []game.Position
+	b := start.Copy()
+	for !b.IsGameOver() {
+		mv := game.Position(-1)
+		if lms := b.LegalMoves(); len(lms) != 0 {
+			mv = lms[rng.Intn(len(lms))]
+		}
+		moves = append(moves, mv)
+		b.MoveUpdate(mv)
+	}
+	if err := bk.AddGame(start, moves); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSearcher(16)
+	s.SetBook(bk, 1)
+	b = start.Copy()
+	b.MoveUpdate(moves[0])
+	mv, _, pv := s.Search(b, Limits{Depth: 2})
+	// the book may give a move equivalent by symmetry
+	if canonical_sfen(b.Move(mv)) != canonical_sfen(b.Move(moves[1])) {
+		t.Errorf("book move %d, want %d", mv, moves[1])
+	}
+	if len(pv) != 1 || s.Nodes() != 0 {
+		t.Errorf("searched a book position: pv %v, %d nodes", pv, s.Nodes())
+	}
+	s.SetBook(bk, 2)
+	if s.Search(b, Limits{Depth: 2}); s.Nodes() == 0 {
+		t.Error("book move played in one game used with min_games 2")
+	}
+}
+
+func canonical_sfen(b *game.Board) string {
+	c, _ := b.Canonical()
+	return c.ToSFEN()
+}
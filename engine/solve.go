@@ -0,0 +1,268 @@
+package engine
+
+import (
+	"errors"
+	"time"
+
+	"eval"
+	"game"
+)
+
+// ErrTimeout is returned by Solver.Solve when the time limit ran out
+// before the game tree was searched to the end.
+var ErrTimeout = errors.New("engine: solver ran out of time")
+
+const (
+	// below this many empties the transposition table costs more than it saves
+	solve_tt_empties = 7
+	// above this many empties moves are ordered fastest-first
+	solve_ff_empties = 6
+)
+
+// Solver finds the exact result of a position under perfect play. The
+// result is the final disc difference, counting discs only as the server
+// does. A Solver must not be used from several goroutines at once.
+type Solver struct {
+	tt *TranspositionTable
+	b *game.Board
+	region_empties [4]int // empties per quadrant, for parity ordering
+	nodes int64
+	deadline time.Time
+	stop bool
+}
+
+func NewSolver(tt_bits int) *Solver {
+	return &Solver{
+		tt: NewTranspositionTable(tt_bits),
+	}
+}
+
+// MoveScore is the exact result of one move.
+type MoveScore struct {
+	Move game.Position
+	Score int // final disc difference for the side that played Move
+}
+
+// Solve is a one-shot Solver.Solve without time limit. It returns the best
+// move for the side to move (-1 to pass) and the final disc difference from
+// that side's point of view.
+func Solve(b *game.Board) (game.Position, int) {
+	mv, score, _ := NewSolver(DefaultTTBits).Solve(b, 0)
+	return mv, score
+}
+
+// Nodes returns the number of nodes visited by the last solve.
+func (s *Solver) Nodes() int64 {
+	return s.nodes
+}
+
+// Solve is like the package function Solve. With a non-zero limit it gives
+// up with ErrTimeout when the limit runs out. b is not modified.
+func (s *Solver) Solve(b *game.Board, limit time.Duration) (game.Position, int, error) {
+	s.start(b, limit)
+	lms := s.b.LegalMoves()
+	if len(lms) == 0 {
+		return -1, s.solve(-infinity, infinity, false), s.timeout()
+	}
+	s.order_moves(lms)
+	best_move := lms[0]
+	alpha := -infinity
+	for _, mv := range lms {
+		if score := s.solve_move(mv, alpha, infinity); score > alpha {
+			alpha = score
+			best_move = mv
+		}
+	}
+	return best_move, alpha, s.timeout()
+}
+
+// SolveMoves returns the exact result of every legal move in b, for
+// post-game analysis. A position without legal moves gives the pass.
+func (s *Solver) SolveMoves(b *game.Board, limit time.Duration) ([]MoveScore, error) {
+	s.start(b, limit)
+	lms := s.b.LegalMoves()
+	if len(lms) == 0 {
+		lms = []game.Position{-1}
+	}
+	var scores []MoveScore
+	for _, mv := range lms {
+		scores = append(scores, MoveScore{mv, s.solve_move(mv, -infinity, infinity)})
+	}
+	return scores, s.timeout()
+}
+
+func (s *Solver) start(b *game.Board, limit time.Duration) {
+	s.b = b.Copy()
+	s.nodes = 0
+	s.stop = false
+	s.deadline = time.Time{}
+	if limit > 0 {
+		s.deadline = time.Now().Add(limit)
+	}
+	s.region_empties = [4]int{}
+	for pos := game.Position(0); int(pos) < b.Boardlen*b.Boardlen; pos++ {
+		if b.Disc(pos) == game.Empty {
+			s.region_empties[s.region(pos)]++
+		}
+	}
+}
+
+func (s *Solver) timeout() error {
+	if s.stop {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// region returns the quadrant of pos.
+func (s *Solver) region(pos game.Position) int {
+	half := s.b.Boardlen / 2
+	x, y := int(pos) / s.b.Boardlen, int(pos) % s.b.Boardlen
+	r := 0
+	if x >= half {
+		r += 2
+	}
+	if y >= half {
+		r += 1
+	}
+	return r
+}
+
+func (s *Solver) solve_move(mv game.Position, alpha int, beta int) int {
+	u := s.b.MoveUpdate(mv)
+	if mv != -1 {
+		s.region_empties[s.region(mv)]--
+	}
+	score := -s.solve(-beta, -alpha, mv == -1)
+	if mv != -1 {
+		s.region_empties[s.region(mv)]++
+	}
+	s.b.Undo(u)
+	return score
+}
+
+// solve is an alpha-beta search to the end of the game. passed tells that
+// the opponent has just passed.
+func (s *Solver) solve(alpha int, beta int, passed bool) int {
+	s.nodes++
+	if s.nodes & 4095 == 0 && !s.deadline.IsZero() && time.Now().After(s.deadline) {
+		s.stop = true
+	}
+	if s.stop {
+		return 0
+	}
+	b := s.b
+	lms := b.LegalMoves()
+	if len(lms) == 0 {
+		if passed {
+			return final_score(b) / DiscScore
+		}
+		return s.solve_move(-1, alpha, beta)
+	}
+
+	empties := b.Boardlen*b.Boardlen - b.DiscNum()
+	use_tt := empties >= solve_tt_empties
+	alpha_orig := alpha
+	key := b.Hash()
+	if use_tt {
+		if e := s.tt.probe(key); e != nil {
+			score := int(e.score)
+			switch e.flag {
+			case tt_exact:
+				return score
+			case tt_lower:
+				if score > alpha {
+					alpha = score
+				}
+			case tt_upper:
+				if score < beta {
+					beta = score
+				}
+			}
+			if alpha >= beta {
+				return score
+			}
+			// try the move that was best last time first
+			for i, mv := range lms {
+				if mv == game.Position(e.move) {
+					lms[0], lms[i] = lms[i], lms[0]
+					break
+				}
+			}
+			s.order_moves(lms[1:])
+		} else {
+			s.order_moves(lms)
+		}
+	} else {
+		s.order_moves(lms)
+	}
+
+	best := -infinity
+	best_move := lms[0]
+	for _, mv := range lms {
+		score := s.solve_move(mv, alpha, beta)
+		if s.stop {
+			return 0
+		}
+		if score > best {
+			best = score
+			best_move = mv
+			if score > alpha {
+				alpha = score
+			}
+		}
+		if alpha >= beta {
+			break
+		}
+	}
+
+	if use_tt {
+		flag := tt_exact
+		if best <= alpha_orig {
+			flag = tt_upper
+		} else if best >= beta {
+			flag = tt_lower
+		}
+		s.tt.store(key, empties, best, flag, best_move)
+	}
+	return best
+}
+
+// order_moves sorts lms best first. With many empties the moves leaving
+// the opponent the fewest replies come first (fastest-first); moves into
+// quadrants with an odd number of empties (parity) and corners break ties.
+// Near the end only parity and corners are used, as counting replies
+// costs more than it saves.
+func (s *Solver) order_moves(lms []game.Position) {
+	if len(lms) < 2 {
+		return
+	}
+	var keys [64]int
+	if len(lms) > len(keys) {
+		// huge boards, order the first moves only
+		lms = lms[:len(keys)]
+	}
+	b := s.b
+	fastest_first := b.Boardlen*b.Boardlen - b.DiscNum() > solve_ff_empties
+	for i, mv := range lms {
+		key := 0
+		if s.region_empties[s.region(mv)] % 2 == 1 {
+			key += 2
+		}
+		if class, _ := eval.SquareClass(b.Boardlen, mv); class == eval.Corner {
+			key += 1
+		}
+		if fastest_first {
+			u := b.MoveUpdate(mv)
+			key -= 8 * len(b.LegalMoves())
+			b.Undo(u)
+		}
+		keys[i] = key
+	}
+	for i := 1; i < len(lms); i++ {
+		for j := i; j > 0 && keys[j] > keys[j-1]; j-- {
+			keys[j], keys[j-1] = keys[j-1], keys[j]
+			lms[j], lms[j-1] = lms[j-1], lms[j]
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"game"
+)
+
+type tt_flag uint8
+
+const (
+	tt_exact tt_flag = iota
+	tt_lower // score is a lower bound (fail high)
+	tt_upper // score is an upper bound (fail low)
+)
+
+type tt_entry struct {
+	key uint64
+	score int32
+	move int32
+	depth int16
+	flag tt_flag
+}
+
+// TranspositionTable caches search results by game.Board.Hash. It is a
+// fixed-size table where a new entry replaces an old one unless the old one
+// is for the same position and was searched deeper.
+type TranspositionTable struct {
+	entries []tt_entry
+	mask uint64
+}
+
+// NewTranspositionTable makes a table with 1<<bits entries.
+func NewTranspositionTable(bits int) *TranspositionTable {
+	n := 1 << bits
+	return &TranspositionTable{
+		entries: make([]tt_entry, n, n),
+		mask: uint64(n - 1),
+	}
+}
+
+func (tt *TranspositionTable) Clear() {
+	for i := range tt.entries {
+		tt.entries[i] = tt_entry{}
+	}
+}
+
+func (tt *TranspositionTable) probe(key uint64) *tt_entry {
+	e := &tt.entries[key & tt.mask]
+	if e.key != key || e.depth == 0 {
+		return nil
+	}
+	return e
+}
+
+func (tt *TranspositionTable) store(key uint64, depth int, score int, flag tt_flag, move game.Position) {
+	e := &tt.entries[key & tt.mask]
+	if e.key == key && int(e.depth) > depth {
+		return
+	}
+	*e = tt_entry{
+		key: key,
+		score: int32(score),
+		move: int32(move),
+		depth: int16(depth),
+		flag: flag,
+	}
+}
@@ -0,0 +1,120 @@
+// Package eval has static evaluation functions for game.Board of any size,
+// to be mixed and weighted per board size.
+package eval
+
+import (
+	"game"
+)
+
+// DiscScore is the score of a one-disc lead. Every Evaluator scores in
+// these units so that features can be mixed.
+const DiscScore = 100
+
+// Evaluator scores a position from the point of view of the side to move.
+// Evaluate may update b as long as it restores it before returning.
+type Evaluator interface {
+	Evaluate(b *game.Board) int
+}
+
+// Term is one feature of a Weighted evaluation.
+type Term struct {
+	Eval Evaluator
+	Weight int // in percent of the feature's own score
+}
+
+// Weighted sums the weighted scores of its terms.
+type Weighted []Term
+
+func (w Weighted) Evaluate(b *game.Board) int {
+	score := 0
+	for _, t := range w {
+		score += t.Weight * t.Eval.Evaluate(b)
+	}
+	return score / 100
+}
+
+// ForBoard returns the default evaluation for boards of boardlen. Small
+// boards are decided by the discs and the corners; on larger ones mobility
+// and quiet moves (few frontier discs) matter more, and a single corner
+// less.
+func ForBoard(boardlen int) Evaluator {
+	switch {
+	case boardlen <= 6:
+		return Weighted{
+			{DiscCount{}, 25},
+			{Mobility{}, 100},
+			{DefaultSquares, 100},
+			{Stability{}, 100},
+		}
+	case boardlen <= 12:
+		return Weighted{
+			{Mobility{}, 100},
+			{PotentialMobility{}, 50},
+			{DefaultSquares, 100},
+			{Stability{}, 100},
+		}
+	}
+	return Weighted{
+		{Mobility{}, 100},
+		{PotentialMobility{}, 50},
+		{DefaultSquares, 50},
+		{Stability{}, 50},
+	}
+}
+
+// Class is the kind of a square, as far as the evaluation is concerned.
+type Class int
+
+const (
+	Inner Class = iota
+	Edge
+	Corner
+	XSquare // diagonal neighbour of a corner
+	CSquare // edge neighbour of a corner
+)
+
+// SquareClass returns the class of pos and, for X- and C-squares, the
+// corner they belong to.
+func SquareClass(boardlen int, pos game.Position) (Class, game.Position) {
+	m := boardlen - 1
+	x, y := int(pos) / boardlen, int(pos) % boardlen
+	// distance to the nearest corner along each axis
+	cx, cy := 0, 0
+	if x > m/2 {
+		cx = m
+	}
+	if y > m/2 {
+		cy = m
+	}
+	dx, dy := x - cx, y - cy
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	corner := game.Position(cx*boardlen + cy)
+	switch {
+	case dx == 0 && dy == 0:
+		return Corner, corner
+	case dx == 1 && dy == 1:
+		return XSquare, corner
+	case dx + dy == 1:
+		return CSquare, corner
+	case x == 0 || y == 0 || x == m || y == m:
+		return Edge, corner
+	}
+	return Inner, corner
+}
+
+// sign is 1 for discs of the side to move, -1 for the opponent's and 0 for
+// empty squares.
+func sign(b *game.Board, disc int) int {
+	switch disc {
+	case game.Empty:
+		return 0
+	case b.Turn:
+		return 1
+	}
+	return -1
+}
@@ -0,0 +1,194 @@
+package eval
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"game"
+)
+
+func random_position(rng *rand.Rand, boardlen int, n_moves int) *game.Board {
+	b := game.NewBoardSFEN(boardlen, game.MakeInitialSFEN(boardlen))
+	for i := 0; i < n_moves && !b.IsGameOver(); i++ {
+		mv := game.Position(-1)
+		if lms := b.LegalMoves(); len(lms) != 0 {
+			mv = lms[rng.Intn(len(lms))]
+		}
+		b.MoveUpdate(mv)
+	}
+	return b
+}
+
+var features = map[string]Evaluator{
+	"DiscCount": DiscCount{},
+	"Mobility": Mobility{},
+	"PotentialMobility": PotentialMobility{},
+	"Squares": DefaultSquares,
+	"Stability": Stability{},
+}
+
+// TestFeatures checks that every feature is symmetric: the same under the
+// board symmetries, and negated for the other side to move.
+func TestFeatures(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{4, 6, 8, 10, 16} {
+		for i := 0; i < 20; i++ {
+			b := random_position(rng, n, rng.Intn(n*n))
+			sfen := b.ToSFEN()
+			for name, e := range features {
+				score := e.Evaluate(b)
+				for sym := game.Symmetry(0); sym < game.NumSymmetries; sym++ {
+					if s := e.Evaluate(b.Transform(sym)); s != score {
+						t.Errorf("%s(%s) = %d, %d under symmetry %d", name, sfen, score, s, sym)
+					}
+				}
+				u := b.MoveUpdate(-1)
+				if s := e.Evaluate(b); s != -score {
+					t.Errorf("%s(%s) = %d, %d for the opponent", name, sfen, score, s)
+				}
+				b.Undo(u)
+				if b.ToSFEN() != sfen {
+					t.Fatalf("%s modified the board", name)
+				}
+			}
+		}
+	}
+}
+
+func TestStability(t *testing.T) {
+	tests := []struct {
+		sfen string
+		score int
+	}{
+		{"8/8/8/3wb3/3bw3/8/8/8 b", 0},
+		// a corner and the edge discs next to it
+		{"bbbw4/b7/8/3wb3/3bw3/8/8/8 b", 4},
+		{"bbbw4/b7/8/3wb3/3bw3/8/8/8 w", -4},
+		// a full inner row is not
+		{"8/8/8/bwbwbwbw/3bw3/8/8/8 b", 0},
+		// a full edge is stable
+		{"bwbwbwbw/8/8/3wb3/3bw3/8/8/8 b", 0},
+		{"bwbwbwbb/8/8/3wb3/3bw3/8/8/8 b", 2},
+		// a full board
+		{strings.Repeat("w", 16) + strings.Repeat("b", 48) + " b", 32},
+	}
+	for _, tt := range tests {
+		b, err := game.ParseSFEN(8, tt.sfen)
+		if err != nil {
+			t.Fatalf("ParseSFEN(%s): %v", tt.sfen, err)
+		}
+		if s := (Stability{}).Evaluate(b); s != tt.score*DiscScore {
+			t.Errorf("Stability(%s) = %d, want %d", tt.sfen, s, tt.score*DiscScore)
+		}
+	}
+}
+
+func TestSquareClass(t *testing.T) {
+	tests := []struct {
+		boardlen int
+		pos game.Position
+		class Class
+		corner game.Position
+	}{
+		{8, 0, Corner, 0},
+		{8, 9, XSquare, 0},
+		{8, 1, CSquare, 0},
+		{8, 8, CSquare, 0},
+		{8, 3, Edge, 0},
+		{8, 63, Corner, 63},
+		{8, 54, XSquare, 63},
+		{8, 14, XSquare, 7},
+		{8, 27, Inner, 0},
+		{10, 4, Edge, 0},
+		{10, 5, Edge, 9},
+	}
+	for _, tt := range tests {
+		class, corner := SquareClass(tt.boardlen, tt.pos)
+		if class != tt.class || corner != tt.corner {
+			t.Errorf("SquareClass(%d, %d) = %d, %d, want %d, %d", tt.boardlen, tt.pos, class, corner, tt.class, tt.corner)
+		}
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	b := game.NewBoardSFEN(8, "bbbw4/b7/8/3wb3/3bw3/8/8/8 b")
+	w := Weighted{{DiscCount{}, 50}, {Stability{}, 200}}
+	want := (50*DiscCount{}.Evaluate(b) + 200*Stability{}.Evaluate(b)) / 100
+	if s := w.Evaluate(b); s != want {
+		t.Errorf("Weighted = %d, want %d", s, want)
+	}
+	for _, n := range []int{4, 8, 26} {
+		ForBoard(n).Evaluate(game.NewBoardSFEN(n, game.MakeInitialSFEN(n)))
+	}
+}
+
+// pattern_samples plays random games and labels their positions with the
+// final disc difference.
+func pattern_samples(p *Pattern, rng *rand.Rand, n_games int) []PatternSample {
+	var samples []PatternSample
+	for g := 0; g < n_games; g++ {
+		b := game.NewBoardSFEN(8, game.MakeInitialSFEN(8))
+		var turns []int
+		first := len(samples)
+		for !b.IsGameOver() {
+			lms := b.LegalMoves()
+			if len(lms) == 0 {
+				b.MoveUpdate(-1)
+				continue
+			}
+			samples = append(samples, PatternSample{Features: p.Features(b, nil)})
+			turns = append(turns, b.Turn)
+			b.MoveUpdate(lms[rng.Intn(len(lms))])
+		}
+		diff := float32(b.CountBlack() - b.CountWhite())
+		for i, turn := range turns {
+			samples[first+i].Score = diff
+			if turn == game.White {
+				samples[first+i].Score = -diff
+			}
+		}
+	}
+	return samples
+}
+
+func TestPattern(t *testing.T) {
+	if n := len(pattern_instances); n != 34 {
+		t.Errorf("%d pattern instances, want 34", n)
+	}
+	p := NewPattern()
+	rng := rand.New(rand.NewSource(3))
+	samples := pattern_samples(p, rng, 200)
+	first := p.Fit(samples, 1)
+	var mse float64
+	for i := 0; i < 50; i++ {
+		mse = p.Fit(samples, 1)
+	}
+	if mse > first/2 {
+		t.Errorf("mean squared error %v after fitting, %v before", mse, first)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	p2, err := ReadPattern(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		b := random_position(rng, 8, rng.Intn(60))
+		if s, s2 := p.Evaluate(b), p2.Evaluate(b); s != s2 {
+			t.Errorf("%s: %d after reading the weights back, want %d", b.ToSFEN(), s2, s)
+		}
+	}
+	if _, err := ReadPattern(bytes.NewReader([]byte("RVPT\x01"))); err == nil {
+		t.Error("ReadPattern accepted a truncated file")
+	}
+
+	b := game.NewBoardSFEN(10, game.MakeInitialSFEN(10))
+	if s, want := p.Evaluate(b), ForBoard(10).Evaluate(b); s != want {
+		t.Errorf("Pattern on 10x10 = %d, want ForBoard's %d", s, want)
+	}
+}
@@ -0,0 +1,90 @@
+package eval
+
+import (
+	"game"
+)
+
+// DiscCount is the disc difference.
+type DiscCount struct{}
+
+func (DiscCount) Evaluate(b *game.Board) int {
+	diff := b.CountBlack() - b.CountWhite()
+	if b.Turn == game.White {
+		diff = -diff
+	}
+	return diff * DiscScore
+}
+
+// Mobility is the difference in the number of legal moves, one move being
+// worth one disc.
+type Mobility struct{}
+
+func (Mobility) Evaluate(b *game.Board) int {
+	return (b.Mobility(b.Turn) - b.Mobility(1 - b.Turn)) * DiscScore
+}
+
+// PotentialMobility counts frontier discs, discs next to an empty square.
+// They give the opponent moves later, so the opponent's frontier discs
+// count for the side to move and its own against it.
+type PotentialMobility struct{}
+
+func (PotentialMobility) Evaluate(b *game.Board) int {
+	mine := b.CountBits(b.FrontierDiscs(b.Turn))
+	theirs := b.CountBits(b.FrontierDiscs(1 - b.Turn))
+	return (theirs - mine) * DiscScore
+}
+
+// Squares weights discs by the class of their square. X- and C-squares are
+// only weighted while their corner is empty.
+type Squares struct {
+	Corner int
+	X int
+	C int
+	Edge int
+}
+
+// DefaultSquares are the weights of the engine's original evaluation.
+var DefaultSquares = Squares{
+	Corner: 8 * DiscScore,
+	X: -4 * DiscScore,
+	C: -DiscScore,
+	Edge: DiscScore / 2,
+}
+
+func (sq Squares) Evaluate(b *game.Board) int {
+	score := 0
+	for pos := game.Position(0); int(pos) < b.Boardlen*b.Boardlen; pos++ {
+		s := sign(b, b.Disc(pos))
+		if s == 0 {
+			continue
+		}
+		w := 0
+		class, corner := SquareClass(b.Boardlen, pos)
+		switch class {
+		case Corner:
+			w = sq.Corner
+		case XSquare:
+			if b.Disc(corner) == game.Empty {
+				w = sq.X
+			}
+		case CSquare:
+			if b.Disc(corner) == game.Empty {
+				w = sq.C
+			}
+		case Edge:
+			w = sq.Edge
+		}
+		score += s * w
+	}
+	return score
+}
+
+// Stability is the difference in stable discs, discs that can never be
+// flipped again (see game.Board.StableDiscs), each worth one disc.
+type Stability struct{}
+
+func (Stability) Evaluate(b *game.Board) int {
+	mine := b.CountBits(b.StableDiscs(b.Turn))
+	theirs := b.CountBits(b.StableDiscs(1 - b.Turn))
+	return (mine - theirs) * DiscScore
+}
@@ -0,0 +1,203 @@
+package eval
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"game"
+)
+
+// PatternStages is the number of game stages of a Pattern, by disc count.
+// Each stage has its own weights.
+const PatternStages = 6
+
+const pattern_boardlen = 8
+
+var pattern_magic = [4]byte{'R', 'V', 'P', 'T'}
+
+// the pattern shapes, as (row, column) squares near the top left corner;
+// every symmetric instance of a shape shares its weights
+var pattern_shapes = [][][2]int{
+	// edge with its two X-squares
+	{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {0, 4}, {0, 5}, {0, 6}, {0, 7}, {1, 1}, {1, 6}},
+	// 3x3 corner
+	{{0, 0}, {0, 1}, {0, 2}, {1, 0}, {1, 1}, {1, 2}, {2, 0}, {2, 1}, {2, 2}},
+	// 2x5 corner
+	{{0, 0}, {0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 0}, {1, 1}, {1, 2}, {1, 3}, {1, 4}},
+	// diagonals of length 8 to 4
+	{{0, 0}, {1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 5}, {6, 6}, {7, 7}},
+	{{0, 1}, {1, 2}, {2, 3}, {3, 4}, {4, 5}, {5, 6}, {6, 7}},
+	{{0, 2}, {1, 3}, {2, 4}, {3, 5}, {4, 6}, {5, 7}},
+	{{0, 3}, {1, 4}, {2, 5}, {3, 6}, {4, 7}},
+	{{0, 4}, {1, 5}, {2, 6}, {3, 7}},
+}
+
+type pattern_instance struct {
+	squares []game.Position
+	offset int32 // of the weights of its shape within a stage
+}
+
+var (
+	pattern_instances []pattern_instance
+	pattern_stage_size int // weights per stage, the last one is a bias
+)
+
+func init() {
+	offset := 0
+	for _, shape := range pattern_shapes {
+		seen := map[string]bool{}
+		for sym := game.Symmetry(0); sym < game.NumSymmetries; sym++ {
+			var squares []game.Position
+			for _, sq := range shape {
+				pos := game.Position(sq[0]*pattern_boardlen + sq[1])
+				squares = append(squares, game.TransformPosition(pattern_boardlen, pos, sym))
+			}
+			// shapes symmetric in themselves give the same squares twice
+			sorted := append([]game.Position{}, squares...)
+			sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+			key := fmt.Sprint(sorted)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			pattern_instances = append(pattern_instances, pattern_instance{squares, int32(offset)})
+		}
+		size := 1
+		for range shape {
+			size *= 3
+		}
+		offset += size
+	}
+	pattern_stage_size = offset + 1
+}
+
+// Pattern evaluates 8x8 boards with tables indexed by the contents of
+// edges, corners and diagonals, fitted to game results (see Fit). The
+// score predicts the final disc difference. Other board sizes are left to
+// ForBoard.
+type Pattern struct {
+	weights []float32
+}
+
+// NewPattern returns a Pattern with all weights zero.
+func NewPattern() *Pattern {
+	return &Pattern{
+		weights: make([]float32, PatternStages*pattern_stage_size),
+	}
+}
+
+func pattern_stage(b *game.Board) int {
+	n := pattern_boardlen*pattern_boardlen
+	return (b.DiscNum() - 4) * PatternStages / (n - 4 + 1)
+}
+
+// Features appends to dst the indices of the weights that add up to the
+// score of b, which must be 8x8.
+func (p *Pattern) Features(b *game.Board, dst []int32) []int32 {
+	base := int32(pattern_stage(b) * pattern_stage_size)
+	for _, pi := range pattern_instances {
+		idx := int32(0)
+		for _, pos := range pi.squares {
+			idx *= 3
+			switch b.Disc(pos) {
+			case game.Empty:
+			case b.Turn:
+				idx += 1
+			default:
+				idx += 2
+			}
+		}
+		dst = append(dst, base + pi.offset + idx)
+	}
+	return append(dst, base + int32(pattern_stage_size-1))
+}
+
+func (p *Pattern) Evaluate(b *game.Board) int {
+	if b.Boardlen != pattern_boardlen {
+		return ForBoard(b.Boardlen).Evaluate(b)
+	}
+	var buf [64]int32
+	score := float32(0)
+	for _, f := range p.Features(b, buf[:0]) {
+		score += p.weights[f]
+	}
+	return int(score * DiscScore)
+}
+
+// PatternSample is a position for Fit: its Features and the final disc
+// difference of its game for the side to move.
+type PatternSample struct {
+	Features []int32
+	Score float32
+}
+
+// Fit does one step of gradient descent on the squared error of the
+// samples and returns the mean squared error before the step. Each weight
+// moves by its share of the mean error of the samples using it, times
+// rate, so rarely seen patterns learn as fast as common ones. Rates up to
+// 1 converge.
+func (p *Pattern) Fit(samples []PatternSample, rate float64) float64 {
+	grad := make([]float64, len(p.weights))
+	count := make([]int32, len(p.weights))
+	sse := 0.0
+	for _, s := range samples {
+		pred := float32(0)
+		for _, f := range s.Features {
+			pred += p.weights[f]
+		}
+		e := float64(s.Score - pred)
+		sse += e*e
+		for _, f := range s.Features {
+			grad[f] += e
+			count[f]++
+		}
+	}
+	share := rate / float64(len(pattern_instances) + 1)
+	for i, g := range grad {
+		if count[i] != 0 {
+			p.weights[i] += float32(share * g / float64(count[i]))
+		}
+	}
+	if len(samples) == 0 {
+		return 0
+	}
+	return sse / float64(len(samples))
+}
+
+type pattern_header struct {
+	Magic [4]byte
+	Stages int32
+	StageSize int32
+}
+
+// Write saves the weights in a little-endian binary format.
+func (p *Pattern) Write(w io.Writer) error {
+	h := pattern_header{pattern_magic, PatternStages, int32(pattern_stage_size)}
+	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, p.weights)
+}
+
+// ReadPattern loads weights saved by Pattern.Write.
+func ReadPattern(r io.Reader) (*Pattern, error) {
+	var h pattern_header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Magic != pattern_magic {
+		return nil, errors.New("eval: not a pattern weights file")
+	}
+	if h.Stages != PatternStages || h.StageSize != int32(pattern_stage_size) {
+		return nil, fmt.Errorf("eval: pattern weights for %d stages of %d, want %d of %d",
+			h.Stages, h.StageSize, PatternStages, pattern_stage_size)
+	}
+	p := NewPattern()
+	if err := binary.Read(r, binary.LittleEndian, p.weights); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
@@ -0,0 +1,147 @@
+package game
+
+// Position analysis for evaluation functions and move hints. Colors are
+// Black and White, independent of Turn. The results are newly allocated.
+
+// axis is one of the four lines through a square: shifting by n moves to
+// the next square of the line, and sentinel is the mask of squares that
+// have a neighbour on both sides along the line.
+type axis struct {
+	n int
+	horizontal bool // the line moves across columns and may wrap around rows
+	sentinel BitMap
+}
+
+func (b *Board) axes() [4]axis {
+	return [4]axis{
+		{1, true, b.h_sentinel},
+		{b.Boardlen, false, b.v_sentinel},
+		{b.Boardlen + 1, true, b.s_sentinel},
+		{b.Boardlen - 1, true, b.s_sentinel},
+	}
+}
+
+// neighbours_into sets dst to the squares that have a square of src as
+// neighbour on either side along a. tmp is a buffer; dst must not alias
+// src or tmp.
+func (b *Board) neighbours_into(dst, src, tmp BitMap, a *axis) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	for _, left := range []bool{true, false} {
+		shift := b.SHRInto
+		if left {
+			shift = b.SHLInto
+		}
+		shift(tmp, src, a.n)
+		if a.horizontal {
+			// a shift across columns is a move to a neighbour unless it
+			// goes from one edge column to the other; those moves have
+			// neither end in h_sentinel
+			b.ANDInto(tmp, tmp, b.h_sentinel)
+			b.ORInto(dst, dst, tmp)
+			b.ANDInto(tmp, src, b.h_sentinel)
+			shift(tmp, tmp, a.n)
+		}
+		b.ORInto(dst, dst, tmp)
+	}
+}
+
+func (b *Board) color_discs(color int) (BitMap, BitMap) {
+	if color == Black {
+		return b.black, b.white
+	}
+	return b.white, b.black
+}
+
+// empties returns the empty squares of the board.
+func (b *Board) empties() BitMap {
+	e := b.NOT(b.OR(b.black, b.white))
+	e[b.bitmapsz-1] &= b.used_bits()
+	return e
+}
+
+// Mobility returns the number of legal moves color would have if it were
+// its turn.
+func (b *Board) Mobility(color int) int {
+	my_pos, op_pos := b.color_discs(color)
+	if b.single {
+		return PopCountUInt64(b.legal_moves64(my_pos[0], op_pos[0]))
+	}
+	legals := b.scratch.legals
+	b.legal_moves_into(legals, my_pos, op_pos)
+	return b.CountBits(legals)
+}
+
+// FrontierDiscs returns the discs of color next to an empty square.
+func (b *Board) FrontierDiscs(color int) BitMap {
+	my_pos, _ := b.color_discs(color)
+	empties := b.empties()
+	next := make(BitMap, b.bitmapsz, b.bitmapsz)
+	tmp := make(BitMap, b.bitmapsz, b.bitmapsz)
+	frontier := make(BitMap, b.bitmapsz, b.bitmapsz)
+	for _, a := range b.axes() {
+		b.neighbours_into(next, empties, tmp, &a)
+		b.ORInto(frontier, frontier, next)
+	}
+	b.ANDInto(frontier, frontier, my_pos)
+	return frontier
+}
+
+// StableDiscs returns discs of color that can never be flipped. A disc is
+// stable when on each of the four lines through it the line is full, or
+// one of its neighbours on the line is the edge or a stable disc of the
+// same color. Some stable discs, such as those only protected by discs of
+// the other color, are not found.
+func (b *Board) StableDiscs(color int) BitMap {
+	my_pos, _ := b.color_discs(color)
+	sz := b.bitmapsz
+	empties := b.empties()
+	axes := b.axes()
+	next := make(BitMap, sz, sz)
+	tmp := make(BitMap, sz, sz)
+
+	// safe[k]: discs that are stable along axis k whatever happens,
+	// because the line is full or they lie on the edge
+	var safe [4]BitMap
+	for k := range axes {
+		a := &axes[k]
+		// spread the empty squares along the line; what they do not
+		// reach is on a full line
+		open := append(BitMap{}, empties...)
+		for {
+			b.neighbours_into(next, open, tmp, a)
+			b.ORInto(next, next, open)
+			if equal_bits(next, open) {
+				break
+			}
+			open, next = next, open
+		}
+		safe[k] = b.NOT(b.AND(open, a.sentinel))
+		b.ANDInto(safe[k], safe[k], my_pos)
+	}
+
+	stable := make(BitMap, sz, sz)
+	grown := make(BitMap, sz, sz)
+	for {
+		copy(grown, my_pos)
+		for k := range axes {
+			b.neighbours_into(next, stable, tmp, &axes[k])
+			b.ORInto(next, next, safe[k])
+			b.ANDInto(grown, grown, next)
+		}
+		if equal_bits(grown, stable) {
+			return stable
+		}
+		stable, grown = grown, stable
+	}
+}
+
+func equal_bits(x, y BitMap) bool {
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
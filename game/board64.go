@@ -0,0 +1,154 @@
+package game
+
+import (
+	"math/bits"
+)
+
+// Single-word fast path.
+// When boardlen*boardlen <= 64 the whole board fits in one uint64, so the
+// BitMap slices of the general implementation are only ever accessed at
+// index 0. The functions below work on that word directly and never
+// allocate. NewBoard sets Board.single and the public methods dispatch here.
+
+func (b *Board) legal_moves64(my_pos, op_pos uint64) uint64 {
+	// unused (lower) bits of the word must never become legal moves
+	used := ^((uint64(1) << b.unused_bits) - 1)
+	opens := ^(my_pos | op_pos) & used
+	mask_V := op_pos & b.v_sentinel[0]
+	mask_H := op_pos & b.h_sentinel[0]
+	mask_S := op_pos & b.s_sentinel[0]
+	shift_len_V := b.Boardlen
+	shift_len_H := 1
+	shift_len_DU := b.Boardlen - 1
+	shift_len_DD := b.Boardlen + 1
+
+	var legals uint64
+	legals |= opens & (run_shl64(my_pos, mask_V, shift_len_V) << shift_len_V)   // UP
+	legals |= opens & (run_shr64(my_pos, mask_V, shift_len_V) >> shift_len_V)   // DOWN
+	legals |= opens & (run_shr64(my_pos, mask_H, shift_len_H) >> shift_len_H)   // RIGHT
+	legals |= opens & (run_shl64(my_pos, mask_H, shift_len_H) << shift_len_H)   // LEFT
+	legals |= opens & (run_shl64(my_pos, mask_S, shift_len_DU) << shift_len_DU) // RIGHT UP
+	legals |= opens & (run_shr64(my_pos, mask_S, shift_len_DU) >> shift_len_DU) // LEFT DOWN
+	legals |= opens & (run_shr64(my_pos, mask_S, shift_len_DD) >> shift_len_DD) // RIGHT DOWN
+	legals |= opens & (run_shl64(my_pos, mask_S, shift_len_DD) << shift_len_DD) // LEFT UP
+	return legals
+}
+
+func (b *Board) flip64(mv Position, my_pos, op_pos uint64) uint64 {
+	move := uint64(0x8000_0000_0000_0000) >> mv
+	mask_V := op_pos & b.v_sentinel[0]
+	mask_H := op_pos & b.h_sentinel[0]
+	mask_S := op_pos & b.s_sentinel[0]
+	shift_len_V := b.Boardlen
+	shift_len_H := 1
+	shift_len_DU := b.Boardlen - 1
+	shift_len_DD := b.Boardlen + 1
+
+	var flips, tmp uint64
+
+	// UP
+	tmp = run_shl64(move, mask_V, shift_len_V)
+	if my_pos & (tmp << shift_len_V) != 0 {
+		flips |= tmp
+	}
+	// DOWN
+	tmp = run_shr64(move, mask_V, shift_len_V)
+	if my_pos & (tmp >> shift_len_V) != 0 {
+		flips |= tmp
+	}
+	// RIGHT
+	tmp = run_shr64(move, mask_H, shift_len_H)
+	if my_pos & (tmp >> shift_len_H) != 0 {
+		flips |= tmp
+	}
+	// LEFT
+	tmp = run_shl64(move, mask_H, shift_len_H)
+	if my_pos & (tmp << shift_len_H) != 0 {
+		flips |= tmp
+	}
+	// RIGHT UP
+	tmp = run_shl64(move, mask_S, shift_len_DU)
+	if my_pos & (tmp << shift_len_DU) != 0 {
+		flips |= tmp
+	}
+	// LEFT DOWN
+	tmp = run_shr64(move, mask_S, shift_len_DU)
+	if my_pos & (tmp >> shift_len_DU) != 0 {
+		flips |= tmp
+	}
+	// RIGHT DOWN
+	tmp = run_shr64(move, mask_S, shift_len_DD)
+	if my_pos & (tmp >> shift_len_DD) != 0 {
+		flips |= tmp
+	}
+	// LEFT UP
+	tmp = run_shl64(move, mask_S, shift_len_DD)
+	if my_pos & (tmp << shift_len_DD) != 0 {
+		flips |= tmp
+	}
+	return flips
+}
+
+// run_shl64 returns the run of mask bits reached from seed by repeatedly
+// shifting left by n. The loop stops as soon as the run cannot grow.
+func run_shl64(seed, mask uint64, n int) uint64 {
+	run := mask & (seed << n)
+	for next := run; next != 0; {
+		next = mask & (next << n)
+		run |= next
+	}
+	return run
+}
+
+func run_shr64(seed, mask uint64, n int) uint64 {
+	run := mask & (seed >> n)
+	for next := run; next != 0; {
+		next = mask & (next >> n)
+		run |= next
+	}
+	return run
+}
+
+func (b *Board) my_op64() (uint64, uint64) {
+	if b.IsBlackTurn() {
+		return b.black[0], b.white[0]
+	}
+	return b.white[0], b.black[0]
+}
+
+func (b *Board) move_update64(mv Position) uint64 {
+	var flipped uint64
+	if mv != -1 {
+		my_pos, op_pos := b.my_op64()
+		flipped = b.flip64(mv, my_pos, op_pos)
+		move := uint64(0x8000_0000_0000_0000) >> mv
+		if b.IsBlackTurn() {
+			b.white[0] &^= flipped
+			b.black[0] |= flipped | move
+			b.hash ^= b.zobrist.black[mv]
+		} else {
+			b.black[0] &^= flipped
+			b.white[0] |= flipped | move
+			b.hash ^= b.zobrist.white[mv]
+		}
+		b.update_hash_word(0, flipped)
+		b.discs += 1
+	}
+	b.Turn = 1 - b.Turn
+	b.ply += 1
+	return flipped
+}
+
+func (b *Board) legal_moves_list64() []Position {
+	legals := b.legal_moves64(b.my_op64())
+	if legals == 0 {
+		return nil
+	}
+	pms := make([]Position, 0, bits.OnesCount64(legals))
+	for legals != 0 {
+		y := bits.LeadingZeros64(legals)
+		pms = append(pms, Position(y))
+		legals &^= uint64(0x8000_0000_0000_0000) >> y
+	}
+	return pms
+}
@@ -2,13 +2,22 @@ package game
 
 import (
 	"fmt"
+	"math/bits"
 	"strconv"
+	"strings"
 )
 
 const (
 	INTSIZE = 64
 )
 
+// square contents returned by Board.Disc; Black and White match Board.Turn
+const (
+	Empty = -1
+	Black = 0
+	White = 1
+)
+
 type BitMap []uint64 
 type Position int
 type Board struct {
@@ -17,11 +26,52 @@ type Board struct {
 	Boardlen int
 	bitmapsz int
 	unused_bits int
+	single bool // board fits in one uint64, see board64.go
 	black BitMap
 	white BitMap
 	h_sentinel BitMap
 	v_sentinel BitMap
 	s_sentinel BitMap
+	// scratch buffers for the multi-word move generator (see NewBoard).
+	// They make a Board unsafe for concurrent use, even read-only.
+	scratch scratch
+	// flipped discs of the moves played by MoveUpdate, see UndoRecord
+	undo_stack BitMap
+	hash uint64 // Zobrist hash of the discs, see Hash
+	ply int // moves played, passes included, see MoveNumber
+	zobrist *zobrist
+}
+
+type scratch struct {
+	opens BitMap
+	mask_V BitMap
+	mask_H BitMap
+	mask_S BitMap
+	run BitMap
+	next BitMap
+	tmp BitMap
+	move BitMap
+	legals BitMap
+	flips BitMap
+}
+
+func new_scratch(bitmapsz int) scratch {
+	buf := make(BitMap, 10*bitmapsz, 10*bitmapsz)
+	part := func(i int) BitMap {
+		return buf[i*bitmapsz:(i+1)*bitmapsz:(i+1)*bitmapsz]
+	}
+	return scratch{
+		opens: part(0),
+		mask_V: part(1),
+		mask_H: part(2),
+		mask_S: part(3),
+		run: part(4),
+		next: part(5),
+		tmp: part(6),
+		move: part(7),
+		legals: part(8),
+		flips: part(9),
+	}
 }
 
 func IsDigit(c byte) bool {
@@ -79,6 +129,7 @@ func NewBoardSFEN(boardlen int, sfen string) *Board {
 		}
 	}
 	b.discs = disc_count
+	b.hash = b.compute_hash()
 	return b
 }
 
@@ -90,15 +141,20 @@ func NewBoard(boardlen int) *Board {
 		Boardlen: boardlen,
 		bitmapsz: bitmapsz,
 		unused_bits: INTSIZE*bitmapsz - boardlen*boardlen,
+		single: bitmapsz == 1,
 		black: make(BitMap, bitmapsz, bitmapsz),
 		white: make(BitMap, bitmapsz, bitmapsz),
 		h_sentinel: BitMap{},
 		v_sentinel: BitMap{},
 		s_sentinel: BitMap{},
+		zobrist: zobrist_table(boardlen),
 	}
 	b.h_sentinel = b.mk_horizontal_sentinel()
 	b.v_sentinel = b.mk_vertical_sentinel()
 	b.s_sentinel = b.mk_sides_sentinel()
+	if !b.single {
+		b.scratch = new_scratch(bitmapsz)
+	}
 	
 	return &b
 }
@@ -107,103 +163,135 @@ func (b *Board) DiscNum() int {
 	return b.discs
 }
 
+// Disc returns Black, White or Empty for the square pos.
+func (b *Board) Disc(pos Position) int {
+	if is_bit_on(b.black, int(pos)) {
+		return Black
+	} else if is_bit_on(b.white, int(pos)) {
+		return White
+	}
+	return Empty
+}
+
+// Copy returns an independent copy of b, without its undo history.
+func (b *Board) Copy() *Board {
+	return b.duplicate()
+}
+
+// MoveNumber returns the number of the next move, counting from 1 and
+// including passes, as written in the move counter field of an SFEN.
+func (b *Board) MoveNumber() int {
+	return b.ply + 1
+}
+
 func (b *Board) OR(x, y BitMap) BitMap {
 	z := make(BitMap, b.bitmapsz, b.bitmapsz)
-	for i := 0; i < b.bitmapsz; i++ {
-		z[i] = x[i] | y[i]
-	}
+	b.ORInto(z, x, y)
 	return z
 }
 
 func (b *Board) AND(x, y BitMap) BitMap {
 	z := make(BitMap, b.bitmapsz, b.bitmapsz)
-	for i := 0; i < b.bitmapsz; i++ {
-		z[i] = x[i] & y[i]
-	}
+	b.ANDInto(z, x, y)
 	return z
 }
 
 func (b *Board) NOT(x BitMap) BitMap {
 	y := make(BitMap, b.bitmapsz, b.bitmapsz)
-	for i := 0; i < b.bitmapsz; i++ {
-		y[i] = ^x[i]
-	}
+	b.NOTInto(y, x)
 	return y
 }
 
 func (b *Board) SHR(a BitMap, n int) BitMap {
 	c := make(BitMap, b.bitmapsz, b.bitmapsz)
-	copy(c,a)
-
-	if n >= INTSIZE {
-		array_shift := n / INTSIZE
-		bit_shift := n % INTSIZE
-		copy(c[array_shift:], c[:len(c)-array_shift])
-		for i := 0; i < array_shift; i++ {
-			c[i] = uint64(0)
-		}
-		n = bit_shift
-		if n == 0 {
-			return c
-		}
-	}
-	if n == 0 {
-		panic("SHR panic")
-	}
-
-	for i := len(c)-1; i > 0; i-- {
-		// n-bit shift to right 
-		c[i] >>= n
-		// the lower n-bits are 1
-		var mask uint64 = (uint64(1) << n) - 1
-		var data uint64 = (c[i-1] & mask) << (INTSIZE-n)
-		c[i] |= data
-	}
-	c[0] >>= n
-	if b.unused_bits != 0 {
-		var mask2 uint64 = ^((uint64(1) << b.unused_bits) - 1)
-		c[len(c)-1] &= mask2
-	}
+	b.SHRInto(c, a, n)
 	return c
 }
 
 func (b *Board) SHL(a BitMap, n int) BitMap {
 	c := make(BitMap, b.bitmapsz, b.bitmapsz)
-	copy(c,a)
-
-	if n >= INTSIZE {
-		array_shift := n / INTSIZE
-		bit_shift := n % INTSIZE
-		copy(c[:len(c)-array_shift], c[array_shift:])
-		for i := len(c)-array_shift; i < len(c); i++ {
-			c[i] = uint64(0)
-		}
-		n = bit_shift
-		if n == 0 {
-			return c
-		}
+	b.SHLInto(c, a, n)
+	return c
+}
+
+// The *Into variants write their result to dst instead of allocating.
+// dst may be the same slice as any of the operands.
+
+func (b *Board) ORInto(dst, x, y BitMap) {
+	for i := 0; i < b.bitmapsz; i++ {
+		dst[i] = x[i] | y[i]
 	}
-	if n == 0 {
-		panic("SHL panic")
+}
+
+func (b *Board) ANDInto(dst, x, y BitMap) {
+	for i := 0; i < b.bitmapsz; i++ {
+		dst[i] = x[i] & y[i]
 	}
-	for i := 0; i < len(c)-1; i++ {
-		// n-bit shift to left
-		c[i] <<= n
-		// the upper n-bits are 1
-		var mask uint64 = ^((uint64(1) << (INTSIZE-n)) - 1)
-		var data uint64 = (c[i+1] & mask) >> (INTSIZE-n)
-		c[i] |= data
+}
+
+func (b *Board) NOTInto(dst, x BitMap) {
+	for i := 0; i < b.bitmapsz; i++ {
+		dst[i] = ^x[i]
 	}
-	if b.unused_bits != 0 {
-		var mask2 uint64 = ^((uint64(1) << b.unused_bits) - 1)
-		c[len(c)-1] &= mask2
+}
+
+func (b *Board) used_bits() uint64 {
+	// the lower unused_bits of the last word are outside the board
+	return ^((uint64(1) << b.unused_bits) - 1)
+}
+
+// SHRInto shifts src right by n bits (towards higher positions) into dst.
+func (b *Board) SHRInto(dst, src BitMap, n int) {
+	sz := b.bitmapsz
+	word_shift := n / INTSIZE
+	bit_shift := uint(n % INTSIZE)
+	used := b.used_bits()
+	// walk downwards so that dst may alias src
+	for i := sz-1; i >= 0; i-- {
+		var w uint64
+		if j := i - word_shift; j >= 0 {
+			hi := src[j]
+			if j == sz-1 {
+				hi &= used
+			}
+			w = hi >> bit_shift
+			if j > 0 {
+				// shifting by INTSIZE yields 0 when bit_shift is 0
+				w |= src[j-1] << (INTSIZE - bit_shift)
+			}
+		}
+		dst[i] = w
+	}
+	dst[sz-1] &= used
+}
+
+// SHLInto shifts src left by n bits (towards lower positions) into dst.
+func (b *Board) SHLInto(dst, src BitMap, n int) {
+	sz := b.bitmapsz
+	word_shift := n / INTSIZE
+	bit_shift := uint(n % INTSIZE)
+	used := b.used_bits()
+	// walk upwards so that dst may alias src
+	for i := 0; i < sz; i++ {
+		var w uint64
+		if j := i + word_shift; j < sz {
+			w = src[j] << bit_shift
+			if j+1 < sz {
+				lo := src[j+1]
+				if j+1 == sz-1 {
+					lo &= used
+				}
+				w |= lo >> (INTSIZE - bit_shift)
+			} else {
+				w &= used << bit_shift
+			}
+		}
+		dst[i] = w
 	}
-	c[len(c)-1] <<= n
-	return c
 }
 
 func (b *Board) is_zero(a BitMap) bool {
-	for i := 0; i < len(a); i++ {
+	for i := 0; i < b.bitmapsz; i++ {
 		if a[i] != uint64(0) {
 			return false
 		}
@@ -245,6 +333,36 @@ func (b *Board) Position2Str(pos Position) string {
 	return y + x
 }
 
+// Str2Position is the inverse of Position2Str. It also accepts upper case
+// and "pass", which gives -1.
+func (b *Board) Str2Position(s string) (Position, error) {
+	move := strings.ToLower(strings.TrimSpace(s))
+	if move == "pass" {
+		return -1, nil
+	}
+	i := 0
+	for i < len(move) && IsLetter(move[i]) {
+		i++
+	}
+	var y int
+	switch i {
+	case 1:
+		y = int(move[0] - 'a')
+	case 2:
+		y = int(move[0] - 'a' + 1)*26 + int(move[1] - 'a')
+	default:
+		return 0, fmt.Errorf("move %q: bad column", s)
+	}
+	x, err := strconv.Atoi(move[i:])
+	if err != nil || move[i] == '0' || move[i] == '+' {
+		return 0, fmt.Errorf("move %q: bad row", s)
+	}
+	if x < 1 || x > b.Boardlen || y >= b.Boardlen {
+		return 0, fmt.Errorf("move %q: outside the %dx%d board", s, b.Boardlen, b.Boardlen)
+	}
+	return Position((x-1)*b.Boardlen + y), nil
+}
+
 func (b *Board) move2BitMap(mv Position) BitMap {
 	bits := make(BitMap, b.bitmapsz, b.bitmapsz)
 	set_bit(bits, int(mv))
@@ -252,34 +370,7 @@ func (b *Board) move2BitMap(mv Position) BitMap {
 }
 
 func (b *Board) ToSFEN() string {
-	var sfen string
-	space_count := 0
-        for pos := 0; pos < b.Boardlen*b.Boardlen; pos++ {
-		if is_bit_on(b.black, pos) {
-			if space_count != 0 {
-				sfen += strconv.Itoa(space_count)
-				space_count = 0
-			}
-			sfen += "b"
-		} else if is_bit_on(b.white, pos) {
-			if space_count != 0 {
-				sfen += strconv.Itoa(space_count)
-				space_count = 0
-			}
-			sfen += "w"
-		} else {
-			space_count++
-		}
-	}
-	if space_count != 0 {
-		sfen += strconv.Itoa(space_count)
-	}
-	if b.IsBlackTurn() {
-		sfen += " b"
-	} else {
-		sfen += " w"
-	}
-	return sfen
+	return b.FormatSFEN(SFENOptions{})
 }
 
 func is_bit_on(bits BitMap, pos int) bool {
@@ -360,43 +451,45 @@ func (b *Board) mk_sides_sentinel() BitMap {
 }
 
 func (b *Board) IsLegalMove(mv Position) bool {
-	var legals BitMap
+	if mv < -1 || int(mv) >= b.Boardlen*b.Boardlen {
+		return false
+	}
+	if b.single {
+		legals := b.legal_moves64(b.my_op64())
+		if mv != -1 {
+			return legals & (uint64(0x8000_0000_0000_0000) >> mv) != 0
+		}
+		return legals == 0
+	}
+	legals := b.scratch.legals
 	if b.IsBlackTurn() {
-		legals = b.LegalMovesBits(b.black, b.white)
+		b.legal_moves_into(legals, b.black, b.white)
 	} else {
-		legals = b.LegalMovesBits(b.white, b.black)
+		b.legal_moves_into(legals, b.white, b.black)
 	}
 	if mv != -1 {
-		move := b.move2BitMap(mv)
-		if b.is_zero(b.AND(move, legals)) {
-			return false
-		} else {
-			return true
-		}
+		return is_bit_on(legals, int(mv))
 	} else {
-		if b.is_zero(legals) {
-			return true
-		} else {
-			return false
-		}
+		return b.is_zero(legals)
 	}
 }
 
 func (b *Board) LegalMoves() []Position {
-	var legals BitMap
+	if b.single {
+		return b.legal_moves_list64()
+	}
+	legals := b.scratch.legals
 	if b.IsBlackTurn() {
-		legals = b.LegalMovesBits(b.black, b.white)
+		b.legal_moves_into(legals, b.black, b.white)
 	} else {
-		legals = b.LegalMovesBits(b.white, b.black)
+		b.legal_moves_into(legals, b.white, b.black)
 	}
 	var pms []Position
 	for x := 0; x < b.bitmapsz; x++ {
-		if legals[x] != 0 {
-			for y := 0; y < INTSIZE; y++ {
-				if legals[x] & (uint64(0x8000_0000_0000_0000) >> y) != 0 {
-					pms = append(pms, Position(x*INTSIZE + y))
-				}
-			}
+		for w := legals[x]; w != 0; {
+			y := bits.LeadingZeros64(w)
+			pms = append(pms, Position(x*INTSIZE + y))
+			w &^= uint64(0x8000_0000_0000_0000) >> y
 		}
 	}
 	return pms
@@ -427,75 +520,111 @@ func printbit(bits BitMap, boardlen int, xx []int, yy []int) {
 }
 
 func (b *Board) LegalMovesBits(my_pos, op_pos BitMap) BitMap {
-	opens := b.NOT(b.OR(my_pos,op_pos))
-	mask_V := b.AND(op_pos, b.v_sentinel)
-	mask_H := b.AND(op_pos, b.h_sentinel)
-	mask_S := b.AND(op_pos, b.s_sentinel)
-	shift_len_V := b.Boardlen
-	shift_len_H := 1
-	shift_len_DU := b.Boardlen - 1
-	shift_len_DD := b.Boardlen + 1	
-
-	legals := make(BitMap, b.bitmapsz, b.bitmapsz)
-	var tmp BitMap
-
-	// UP
-	tmp = b.AND(mask_V, b.SHL(my_pos,shift_len_V))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_V, b.SHL(tmp,shift_len_V)))
-	}
-	legals = b.OR(legals, b.AND(opens, b.SHL(tmp,shift_len_V)))
-
-	// DOWN
-	tmp = b.AND(mask_V, b.SHR(my_pos,shift_len_V))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_V, b.SHR(tmp,shift_len_V)))
-	}
-	legals = b.OR(legals, b.AND(opens, b.SHR(tmp,shift_len_V)))
-
-	// RIGHT
-	tmp = b.AND(mask_H, b.SHR(my_pos,shift_len_H))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_H, b.SHR(tmp,shift_len_H)))
+	if b.single {
+		return BitMap{b.legal_moves64(my_pos[0], op_pos[0])}
 	}
-	legals = b.OR(legals, b.AND(opens, b.SHR(tmp,shift_len_H)))
-
-	// LEFT
-	tmp = b.AND(mask_H, b.SHL(my_pos,shift_len_H))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_H, b.SHL(tmp,shift_len_H)))
-	}
-	legals = b.OR(legals, b.AND(opens, b.SHL(tmp,shift_len_H)))
-
-	// RIGHT UP
-	tmp = b.AND(mask_S, b.SHL(my_pos,shift_len_DU))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHL(tmp,shift_len_DU)))
-	}
-	legals = b.OR(legals, b.AND(opens, b.SHL(tmp,shift_len_DU)))
+	legals := make(BitMap, b.bitmapsz, b.bitmapsz)
+	b.legal_moves_into(legals, my_pos, op_pos)
+	return legals
+}
 
-	// LEFT DOWN
-	tmp = b.AND(mask_S, b.SHR(my_pos,shift_len_DU))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHR(tmp,shift_len_DU)))
-	}
-	legals = b.OR(legals, b.AND(opens, b.SHR(tmp,shift_len_DU)))
+type direction struct {
+	mask BitMap
+	shift int
+	left bool
+}
 
-	// RIGHT DOWN
-	tmp = b.AND(mask_S, b.SHR(my_pos,shift_len_DD))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHR(tmp,shift_len_DD)))
+// directions returns the 8 scan directions with the opponent discs that may
+// be part of a run in that direction. The masks live in b.scratch.
+func (b *Board) directions(op_pos BitMap) [8]direction {
+	sc := &b.scratch
+	b.ANDInto(sc.mask_V, op_pos, b.v_sentinel)
+	b.ANDInto(sc.mask_H, op_pos, b.h_sentinel)
+	b.ANDInto(sc.mask_S, op_pos, b.s_sentinel)
+	shift_len_V := b.Boardlen
+	shift_len_H := 1
+	shift_len_DU := b.Boardlen - 1
+	shift_len_DD := b.Boardlen + 1
+	return [8]direction{
+		{sc.mask_V, shift_len_V, true},   // UP
+		{sc.mask_V, shift_len_V, false},  // DOWN
+		{sc.mask_H, shift_len_H, false},  // RIGHT
+		{sc.mask_H, shift_len_H, true},   // LEFT
+		{sc.mask_S, shift_len_DU, true},  // RIGHT UP
+		{sc.mask_S, shift_len_DU, false}, // LEFT DOWN
+		{sc.mask_S, shift_len_DD, false}, // RIGHT DOWN
+		{sc.mask_S, shift_len_DD, true},  // LEFT UP
+	}
+}
+
+// step computes dst = shift(src) & mask in one pass and reports whether
+// the result is non-zero. src and mask must have no bits outside the board.
+func (b *Board) step(dst, src, mask BitMap, n int, left bool) bool {
+	sz := b.bitmapsz
+	word_shift := n / INTSIZE
+	bit_shift := uint(n % INTSIZE)
+	dst, src, mask = dst[:sz], src[:sz], mask[:sz]
+	var any uint64
+	if left {
+		for i := 0; i < sz; i++ {
+			var w uint64
+			if j := i + word_shift; j < sz {
+				w = src[j] << bit_shift
+				if j+1 < sz {
+					w |= src[j+1] >> (INTSIZE - bit_shift)
+				}
+			}
+			w &= mask[i]
+			dst[i] = w
+			any |= w
+		}
+	} else {
+		for i := sz-1; i >= 0; i-- {
+			var w uint64
+			if j := i - word_shift; j >= 0 {
+				w = src[j] >> bit_shift
+				if j > 0 {
+					w |= src[j-1] << (INTSIZE - bit_shift)
+				}
+			}
+			w &= mask[i]
+			dst[i] = w
+			any |= w
+		}
 	}
-	legals = b.OR(legals, b.AND(opens, b.SHR(tmp,shift_len_DD)))
-	
-	// LEFT UP
-	tmp = b.AND(mask_S, b.SHL(my_pos,shift_len_DD))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHL(tmp,shift_len_DD)))
+	return any != 0
+}
+
+// run_into stores in b.scratch.run the mask bits reached from seed by
+// repeated shifts in direction d. It stops as soon as the run cannot grow.
+func (b *Board) run_into(seed BitMap, d *direction) {
+	run := b.scratch.run
+	next := b.scratch.next
+	more := b.step(next, seed, d.mask, d.shift, d.left)
+	copy(run, next)
+	for more {
+		more = b.step(next, next, d.mask, d.shift, d.left)
+		b.ORInto(run, run, next)
+	}
+}
+
+// legal_moves_into is the allocation-free version of LegalMovesBits.
+// dst must not be one of the b.scratch buffers other than legals.
+func (b *Board) legal_moves_into(dst, my_pos, op_pos BitMap) {
+	sc := &b.scratch
+	b.ORInto(sc.opens, my_pos, op_pos)
+	b.NOTInto(sc.opens, sc.opens)
+	sc.opens[b.bitmapsz-1] &= b.used_bits()
+	for i := range dst {
+		dst[i] = 0
+	}
+	dirs := b.directions(op_pos)
+	for k := range dirs {
+		b.run_into(my_pos, &dirs[k])
+		if b.step(sc.tmp, sc.run, sc.opens, dirs[k].shift, dirs[k].left) {
+			b.ORInto(dst, dst, sc.tmp)
+		}
 	}
-	legals = b.OR(legals, b.AND(opens, b.SHL(tmp,shift_len_DD)))
-
-	return legals
 }
 
 func (b *Board) duplicate() *Board {
@@ -505,60 +634,132 @@ func (b *Board) duplicate() *Board {
 		Boardlen: b.Boardlen,
 		bitmapsz: b.bitmapsz,
 		unused_bits: b.unused_bits,
+		single: b.single,
 		black: make(BitMap, b.bitmapsz,b.bitmapsz),
 		white: make(BitMap, b.bitmapsz,b.bitmapsz),
 		h_sentinel: b.h_sentinel,
 		v_sentinel: b.v_sentinel,
 		s_sentinel: b.s_sentinel,
+		hash: b.hash,
+		ply: b.ply,
+		zobrist: b.zobrist,
+	}
+	if !b2.single {
+		b2.scratch = new_scratch(b2.bitmapsz)
 	}
 	copy(b2.black, b.black)
 	copy(b2.white, b.white)
 	return b2
 }
 
+// UndoRecord holds what MoveUpdate changed, so that Board.Undo can restore
+// the exact prior state.
+type UndoRecord struct {
+	Move Position
+	Flipped BitMap // discs turned over by Move, nil for a pass
+	Turn int // side to move before Move
+	Discs int // disc count before Move
+	hash uint64
+	ply int
+}
+
 func (b *Board) Move(mv Position) *Board {
 	b2 := b.duplicate()
+	if b2.single {
+		b2.move_update64(mv)
+	} else {
+		b2.move_update_bits(mv)
+	}
+	return b2
+}
+
+// MoveUpdate plays mv on b itself. The flipped discs of the returned record
+// are kept on a stack inside b, so records must be undone in reverse order
+// of the moves, as a tree search naturally does.
+func (b *Board) MoveUpdate(mv Position) UndoRecord {
+	u := UndoRecord{
+		Move: mv,
+		Turn: b.Turn,
+		Discs: b.discs,
+		hash: b.hash,
+		ply: b.ply,
+	}
+	if b.single {
+		flipped := b.move_update64(mv)
+		if mv != -1 {
+			b.undo_stack = append(b.undo_stack, flipped)
+		}
+	} else {
+		flipped := b.move_update_bits(mv)
+		if mv != -1 {
+			b.undo_stack = append(b.undo_stack, flipped...)
+		}
+	}
 	if mv != -1 {
-		move := b2.move2BitMap(mv)
-		flipped_discs := b2.flip(mv)
-		if b2.IsBlackTurn() {
-			b2.white = b2.AND(b2.white, b2.NOT(flipped_discs))
-			b2.black = b2.OR(b2.black, flipped_discs)
-			b2.black = b2.OR(b2.black, move)
+		n := len(b.undo_stack)
+		u.Flipped = b.undo_stack[n-b.bitmapsz:n:n]
+	}
+	return u
+}
+
+// Undo takes back the move recorded in u, which must be the last record
+// returned by MoveUpdate that has not been undone yet.
+func (b *Board) Undo(u UndoRecord) {
+	if u.Move != -1 {
+		var my_pos, op_pos BitMap
+		if u.Turn == 0 {
+			my_pos, op_pos = b.black, b.white
 		} else {
-			b2.black = b2.AND(b2.black, b2.NOT(flipped_discs))
-			b2.white = b2.OR(b2.white, flipped_discs)
-			b2.white = b2.OR(b2.white, move)
+			my_pos, op_pos = b.white, b.black
 		}
-		b2.discs += 1
+		for i := 0; i < b.bitmapsz; i++ {
+			my_pos[i] &^= u.Flipped[i]
+			op_pos[i] |= u.Flipped[i]
+		}
+		clear_bit(my_pos, int(u.Move))
+		b.undo_stack = b.undo_stack[:len(b.undo_stack)-b.bitmapsz]
 	}
-	b2.Turn = 1 - b2.Turn
-	return b2
+	b.Turn = u.Turn
+	b.discs = u.Discs
+	b.hash = u.hash
+	b.ply = u.ply
 }
 
-func (b *Board) MoveUpdate(mv Position) {
+// move_update_bits is the multi-word version of move_update64. The
+// returned flipped discs live in b.scratch.
+func (b *Board) move_update_bits(mv Position) BitMap {
+	var flipped_discs BitMap
 	if mv != -1 {
-		move := b.move2BitMap(mv)
-		flipped_discs := b.flip(mv)
+		flipped_discs = b.flip(mv)
+		move := b.scratch.move
+		var my_pos, op_pos BitMap
 		if b.IsBlackTurn() {
-			b.white = b.AND(b.white, b.NOT(flipped_discs))
-			b.black = b.OR(b.black, flipped_discs)
-			b.black = b.OR(b.black, move)
+			my_pos, op_pos = b.black, b.white
 		} else {
-			b.black = b.AND(b.black, b.NOT(flipped_discs))
-			b.white = b.OR(b.white, flipped_discs)
-			b.white = b.OR(b.white, move)
+			my_pos, op_pos = b.white, b.black
 		}
+		for i := 0; i < b.bitmapsz; i++ {
+			my_pos[i] |= flipped_discs[i] | move[i]
+			op_pos[i] &^= flipped_discs[i]
+		}
+		b.update_hash(mv, b.Turn, flipped_discs)
 		b.discs += 1
 	}
 	b.Turn = 1 - b.Turn
+	b.ply += 1
+	return flipped_discs
 }
 
 func (b *Board) IsGameOver() bool {
-	bits0 := b.LegalMovesBits(b.black, b.white)
-	if b.is_zero(bits0) {
-		bits1 := b.LegalMovesBits(b.white, b.black)
-		if b.is_zero(bits1) {
+	if b.single {
+		return b.legal_moves64(b.black[0], b.white[0]) == 0 &&
+			b.legal_moves64(b.white[0], b.black[0]) == 0
+	}
+	legals := b.scratch.legals
+	b.legal_moves_into(legals, b.black, b.white)
+	if b.is_zero(legals) {
+		b.legal_moves_into(legals, b.white, b.black)
+		if b.is_zero(legals) {
 			return true
 		}
 	}
@@ -575,14 +776,15 @@ func PopCountUInt64(i uint64) (c int) {
 }
 
 func (b *Board) CountBlack() int {
-	return b.count_bits(b.black)
+	return b.CountBits(b.black)
 }
 
 func (b *Board) CountWhite() int {
-	return b.count_bits(b.white)
+	return b.CountBits(b.white)
 }
 
-func (b *Board) count_bits(bits BitMap) int {
+// CountBits returns the number of squares set in bits.
+func (b *Board) CountBits(bits BitMap) int {
 	count := 0
 	for i := 0; i < len(bits); i++ {
 		count += PopCountUInt64(bits[i])
@@ -590,101 +792,34 @@ func (b *Board) count_bits(bits BitMap) int {
 	return count
 }
 
+// flip returns the discs flipped by mv in b.scratch.flips, and leaves the
+// bit of mv itself in b.scratch.move.
 func (b *Board) flip(mv Position) BitMap {
-	move := b.move2BitMap(mv)
-	my_pos := make(BitMap, b.bitmapsz, b.bitmapsz)
-	op_pos := make(BitMap, b.bitmapsz, b.bitmapsz)
+	sc := &b.scratch
+	move := sc.move
+	for i := range move {
+		move[i] = 0
+	}
+	set_bit(move, int(mv))
 
+	var my_pos, op_pos BitMap
 	if b.IsBlackTurn() {
-		copy(my_pos, b.black)
-		copy(op_pos, b.white)
+		my_pos, op_pos = b.black, b.white
 	} else {
-		copy(my_pos, b.white)
-		copy(op_pos, b.black)
-	}
-
-	flips := make(BitMap, b.bitmapsz, b.bitmapsz)
-	mask_V := b.AND(op_pos, b.v_sentinel)
-	mask_H := b.AND(op_pos, b.h_sentinel)
-	mask_S := b.AND(op_pos, b.s_sentinel)
-	shift_len_V := b.Boardlen
-	shift_len_H := 1
-	shift_len_DU := b.Boardlen - 1
-	shift_len_DD := b.Boardlen + 1	
-	var tmp BitMap
-	
-	// UP
-	tmp = b.AND(mask_V, b.SHL(move,shift_len_V))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_V, b.SHL(tmp,shift_len_V)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHL(tmp,shift_len_V))) {
-		flips = b.OR(flips, tmp)
+		my_pos, op_pos = b.white, b.black
 	}
 
-	// DOWN
-	tmp = b.AND(mask_V, b.SHR(move,shift_len_V))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_V, b.SHR(tmp,shift_len_V)))
+	flips := sc.flips
+	for i := range flips {
+		flips[i] = 0
 	}
-	if !b.is_zero(b.AND(my_pos, b.SHR(tmp,shift_len_V))) {
-		flips = b.OR(flips, tmp)
-	}
-
-	// RIGHT
-	tmp = b.AND(mask_H, b.SHR(move,shift_len_H))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_H, b.SHR(tmp,shift_len_H)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHR(tmp,shift_len_H))) {
-		flips = b.OR(flips, tmp)
-	}
-
-	// LEFT
-	tmp = b.AND(mask_H, b.SHL(move,shift_len_H))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_H, b.SHL(tmp,shift_len_H)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHL(tmp,shift_len_H))) {
-		flips = b.OR(flips, tmp)
-	}
-
-	// RIGHT UP
-	tmp = b.AND(mask_S, b.SHL(move,shift_len_DU))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHL(tmp,shift_len_DU)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHL(tmp,shift_len_DU))) {
-		flips = b.OR(flips, tmp)
-	}
-
-	// LEFT DOWN
-	tmp = b.AND(mask_S, b.SHR(move,shift_len_DU))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHR(tmp,shift_len_DU)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHR(tmp,shift_len_DU))) {
-		flips = b.OR(flips, tmp)
-	}
-
-	// RIGHT DOWN
-	tmp = b.AND(mask_S, b.SHR(move,shift_len_DD))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHR(tmp,shift_len_DD)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHR(tmp,shift_len_DD))) {
-		flips = b.OR(flips, tmp)
-	}
-	
-	// LEFT UP
-	tmp = b.AND(mask_S, b.SHL(move,shift_len_DD))
-	for i := 0; i < b.Boardlen-3; i++ {
-		tmp = b.OR(tmp, b.AND(mask_S, b.SHL(tmp,shift_len_DD)))
-	}
-	if !b.is_zero(b.AND(my_pos, b.SHL(tmp,shift_len_DD))) {
-		flips = b.OR(flips, tmp)
+	dirs := b.directions(op_pos)
+	for k := range dirs {
+		b.run_into(move, &dirs[k])
+		if b.step(sc.tmp, sc.run, my_pos, dirs[k].shift, dirs[k].left) {
+			b.ORInto(flips, flips, sc.run)
+		}
 	}
-
 	return flips
 }
 
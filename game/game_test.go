@@ -0,0 +1,775 @@
+package game
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPerft8(t *testing.T) {
+	// well known perft numbers of the standard 8x8 starting position
+	tests := []struct {
+		depth int
+		nodes int64
+	}{
+		{1, 4},
+		{2, 12},
+		{3, 56},
+		{4, 244},
+		{5, 1396},
+		{6, 8200},
+		{7, 55092},
+		{8, 390216},
+		{9, 3005288},
+	}
+	b := NewBoardSFEN(8, MakeInitialSFEN(8))
+	for _, tt := range tests {
+		if tt.depth == 9 && testing.Short() {
+			continue
+		}
+		if got := Perft(b, tt.depth); got != tt.nodes {
+			t.Errorf("Perft(8x8, %d) = %d, want %d", tt.depth, got, tt.nodes)
+		}
+	}
+}
+
+func TestPerftNaive(t *testing.T) {
+	tests := []struct {
+		boardlen int
+		depth int
+	}{
+		{4, 10},
+		{6, 6},
+		{10, 5},
+		{16, 4},
+	}
+	for _, tt := range tests {
+		b := NewBoardSFEN(tt.boardlen, MakeInitialSFEN(tt.boardlen))
+		want := naive_perft(new_naive_board(b), tt.depth)
+		if got := Perft(b, tt.depth); got != want {
+			t.Errorf("Perft(%dx%d, %d) = %d, naive = %d", tt.boardlen, tt.boardlen, tt.depth, got, want)
+		}
+	}
+}
+
+// TestLegalMovesNaive plays random games on every even board size and
+// compares the bitboard generator and flips with the naive reference.
+func TestLegalMovesNaive(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	n_games := 10
+	if testing.Short() {
+		n_games = 2
+	}
+	for boardlen := 4; boardlen <= 26; boardlen += 2 {
+		for g := 0; g < n_games; g++ {
+			b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+			nb := new_naive_board(b)
+			for {
+				var my_pos, op_pos BitMap
+				if b.IsBlackTurn() {
+					my_pos, op_pos = b.black, b.white
+				} else {
+					my_pos, op_pos = b.white, b.black
+				}
+				legals := b.LegalMovesBits(my_pos, op_pos)
+				want := nb.legal_moves()
+				got := []Position{}
+				for pos := 0; pos < boardlen*boardlen; pos++ {
+					if is_bit_on(legals, pos) {
+						got = append(got, Position(pos))
+					}
+				}
+				if !equal_moves(got, want) {
+					t.Fatalf("%dx%d %s: LegalMovesBits = %v, naive = %v",
+						boardlen, boardlen, b.ToSFEN(), got, want)
+				}
+				if lms := b.LegalMoves(); !equal_moves(lms, want) {
+					t.Fatalf("%dx%d %s: LegalMoves = %v, naive = %v",
+						boardlen, boardlen, b.ToSFEN(), lms, want)
+				}
+				if b.IsGameOver() != nb.is_game_over() {
+					t.Fatalf("%dx%d %s: IsGameOver = %v", boardlen, boardlen, b.ToSFEN(), b.IsGameOver())
+				}
+				if b.IsGameOver() {
+					break
+				}
+				mv := Position(-1)
+				if len(want) != 0 {
+					mv = want[rng.Intn(len(want))]
+				}
+				if !b.IsLegalMove(mv) {
+					t.Fatalf("%dx%d %s: IsLegalMove(%d) = false", boardlen, boardlen, b.ToSFEN(), mv)
+				}
+				b.MoveUpdate(mv)
+				nb.move(mv)
+				if b.ToSFEN() != nb.to_sfen() {
+					t.Fatalf("%dx%d after %d: %s, naive %s", boardlen, boardlen, mv, b.ToSFEN(), nb.to_sfen())
+				}
+				if b.DiscNum() != b.CountBlack() + b.CountWhite() {
+					t.Fatalf("%dx%d %s: DiscNum = %d", boardlen, boardlen, b.ToSFEN(), b.DiscNum())
+				}
+			}
+		}
+	}
+}
+
+func TestUndo(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, boardlen := range []int{4, 6, 8, 10, 16} {
+		b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+		var sfens []string
+		var records []UndoRecord
+		for !b.IsGameOver() {
+			mv := Position(-1)
+			if lms := b.LegalMoves(); len(lms) != 0 {
+				mv = lms[rng.Intn(len(lms))]
+			}
+			sfens = append(sfens, b.FormatSFEN(SFENOptions{MoveCounter: true}))
+			discs := b.DiscNum()
+			u := b.MoveUpdate(mv)
+			if u.Move != mv || u.Discs != discs {
+				t.Fatalf("%dx%d: record %+v after move %d", boardlen, boardlen, u, mv)
+			}
+			records = append(records, u)
+		}
+		for i := len(records)-1; i >= 0; i-- {
+			b.Undo(records[i])
+			if sfen := b.FormatSFEN(SFENOptions{MoveCounter: true}); sfen != sfens[i] {
+				t.Fatalf("%dx%d: Undo(%d) = %s, want %s", boardlen, boardlen, records[i].Move, sfen, sfens[i])
+			}
+			if b.DiscNum() != b.CountBlack() + b.CountWhite() {
+				t.Fatalf("%dx%d %s: DiscNum = %d", boardlen, boardlen, b.ToSFEN(), b.DiscNum())
+			}
+		}
+		if len(b.undo_stack) != 0 {
+			t.Errorf("%dx%d: %d words left on the undo stack", boardlen, boardlen, len(b.undo_stack))
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, boardlen := range []int{4, 8, 10, 26} {
+		b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+		seen := map[uint64]string{}
+		var records []UndoRecord
+		var hashes []uint64
+		for !b.IsGameOver() {
+			want := NewBoardSFEN(boardlen, b.ToSFEN()).Hash()
+			if b.Hash() != want {
+				t.Fatalf("%dx%d %s: Hash = %x, from scratch %x", boardlen, boardlen, b.ToSFEN(), b.Hash(), want)
+			}
+			if sfen, ok := seen[b.Hash()]; ok && sfen != b.ToSFEN() {
+				t.Fatalf("%dx%d: hash collision between %s and %s", boardlen, boardlen, sfen, b.ToSFEN())
+			}
+			seen[b.Hash()] = b.ToSFEN()
+			mv := Position(-1)
+			if lms := b.LegalMoves(); len(lms) != 0 {
+				mv = lms[rng.Intn(len(lms))]
+			}
+			if b2 := b.Move(mv); b2.Hash() != NewBoardSFEN(boardlen, b2.ToSFEN()).Hash() {
+				t.Fatalf("%dx%d %s: Move(%d) hash mismatch", boardlen, boardlen, b.ToSFEN(), mv)
+			}
+			hashes = append(hashes, b.Hash())
+			records = append(records, b.MoveUpdate(mv))
+		}
+		for i := len(records)-1; i >= 0; i-- {
+			b.Undo(records[i])
+			if b.Hash() != hashes[i] {
+				t.Fatalf("%dx%d: hash after Undo(%d) = %x, want %x", boardlen, boardlen, records[i].Move, b.Hash(), hashes[i])
+			}
+		}
+		b.Turn = 1 - b.Turn
+		if b.Hash() == hashes[0] {
+			t.Errorf("%dx%d: side to move does not change the hash", boardlen, boardlen)
+		}
+	}
+}
+
+func TestSymmetry(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for _, boardlen := range []int{4, 8, 10} {
+		b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+		for !b.IsGameOver() {
+			canon, canon_sym := b.Canonical()
+			if b.Transform(canon_sym).ToSFEN() != canon.ToSFEN() {
+				t.Fatalf("%dx%d %s: Canonical symmetry %d does not map onto %s",
+					boardlen, boardlen, b.ToSFEN(), canon_sym, canon.ToSFEN())
+			}
+			lms := b.LegalMoves()
+			for sym := Identity; sym < NumSymmetries; sym++ {
+				b2 := b.Transform(sym)
+				if back := b2.Transform(sym.Inverse()); back.ToSFEN() != b.ToSFEN() {
+					t.Fatalf("%dx%d %s: Transform(%d) then inverse = %s", boardlen, boardlen, b.ToSFEN(), sym, back.ToSFEN())
+				}
+				if b2.Hash() != NewBoardSFEN(boardlen, b2.ToSFEN()).Hash() {
+					t.Fatalf("%dx%d %s: Transform(%d) hash mismatch", boardlen, boardlen, b.ToSFEN(), sym)
+				}
+				if c, _ := b2.Canonical(); c.ToSFEN() != canon.ToSFEN() {
+					t.Fatalf("%dx%d %s: Canonical of Transform(%d) = %s, want %s",
+						boardlen, boardlen, b.ToSFEN(), sym, c.ToSFEN(), canon.ToSFEN())
+				}
+				want := map[Position]bool{}
+				for _, mv := range lms {
+					want[TransformPosition(boardlen, mv, sym)] = true
+				}
+				lms2 := b2.LegalMoves()
+				if len(lms2) != len(want) {
+					t.Fatalf("%dx%d %s: Transform(%d) has %d legal moves, want %d",
+						boardlen, boardlen, b.ToSFEN(), sym, len(lms2), len(want))
+				}
+				for _, mv := range lms2 {
+					if !want[mv] {
+						t.Fatalf("%dx%d %s: Transform(%d) legal move %d not mapped", boardlen, boardlen, b.ToSFEN(), sym, mv)
+					}
+				}
+			}
+			mv := Position(-1)
+			if len(lms) != 0 {
+				mv = lms[rng.Intn(len(lms))]
+			}
+			b.MoveUpdate(mv)
+		}
+	}
+}
+
+func TestTransformPosition(t *testing.T) {
+	// a1 (row 0, column 0) on 8x8
+	tests := []struct {
+		sym Symmetry
+		want Position
+	}{
+		{Identity, 0},
+		{Rotate90, 7},
+		{Rotate180, 63},
+		{Rotate270, 56},
+		{FlipHorizontal, 7},
+		{FlipVertical, 56},
+		{FlipDiagonal, 0},
+		{FlipAntiDiagonal, 63},
+	}
+	for _, tt := range tests {
+		if got := TransformPosition(8, 0, tt.sym); got != tt.want {
+			t.Errorf("TransformPosition(8, 0, %d) = %d, want %d", tt.sym, got, tt.want)
+		}
+	}
+	if got := TransformPosition(8, -1, Rotate90); got != -1 {
+		t.Errorf("TransformPosition(8, -1, Rotate90) = %d, want -1", got)
+	}
+}
+
+func TestParseSFEN(t *testing.T) {
+	valid := []struct {
+		boardlen int
+		sfen string
+	}{
+		{8, MakeInitialSFEN(8)},
+		{8, "27wb6bw27 b"},
+		{8, "27wb6bw27 w"},
+		{8, "8/8/8/3wb3/3bw3/8/8/8 b"},
+		{4, "5wb2bw5 b"},
+		{4, "4/1wb1/1bw1/4 w"},
+		{4, "4/1wb1/1bw1/4 w 2"},
+		{0, "4/1wb1/1bw1/4 w 2"},
+		{26, MakeInitialSFEN(26)},
+	}
+	for _, tt := range valid {
+		b, err := ParseSFEN(tt.boardlen, tt.sfen)
+		if err != nil {
+			t.Errorf("ParseSFEN(%d, %q) error: %v", tt.boardlen, tt.sfen, err)
+			continue
+		}
+		want := NewBoardSFEN(b.Boardlen, tt.sfen)
+		if b.ToSFEN() != want.ToSFEN() || b.Hash() != want.Hash() || b.DiscNum() != want.DiscNum() {
+			t.Errorf("ParseSFEN(%d, %q) = %s, want %s", tt.boardlen, tt.sfen, b.ToSFEN(), want.ToSFEN())
+		}
+	}
+
+	invalid := []struct {
+		boardlen int
+		sfen string
+	}{
+		{8, ""},
+		{8, "27wb6bw27"},                  // no side to move
+		{8, "27wb6bw27 b x"},              // bad move counter
+		{8, "27wb6bw27 b 0"},              // bad move counter
+		{8, "27wb6bw27 b 1 2"},            // extra field
+		{8, "27wb6bw26 b"},                // too short
+		{8, "27wb6bw28 b"},                // too long
+		{8, "27wb6bw27b b"},               // disc past the end
+		{8, "27wb6bx27 b"},                // unknown character
+		{8, "27WB6BW27 b"},                // upper case
+		{8, "27wb6bw27 black"},            // bad side to move
+		{8, "0027wb6bw27 b"},              // leading zero
+		{8, "0wb6bw27 b"},                 // zero count
+		{8, "8/8/8/3wb3/3bw3/8/8/8/ b"},   // trailing separator
+		{8, "8/8/8/3wb3/3bw3/8/16 b"},     // count across a row
+		{8, "8/8/8/3wb2/4bw3/8/8/8 b"},    // separator inside a row
+		{8, "8//8/3wb3/3bw3/8/8/16 b"},    // doubled separator
+		{4, "4/1wb1/1bw1/4 x"},
+		{8, "4/1wb1/1bw1/4 b"},
+		{0, "5wb2bw5 b"},
+		{0, "b"},
+	}
+	for _, tt := range invalid {
+		if b, err := ParseSFEN(tt.boardlen, tt.sfen); err == nil {
+			t.Errorf("ParseSFEN(%d, %q) = %s, want error", tt.boardlen, tt.sfen, b.ToSFEN())
+		}
+	}
+}
+
+func TestFormatSFEN(t *testing.T) {
+	b := NewBoardSFEN(8, MakeInitialSFEN(8))
+	b.MoveUpdate(19)
+	tests := []struct {
+		opt SFENOptions
+		want string
+	}{
+		{SFENOptions{}, "19b7bb6bw27 w"},
+		{SFENOptions{Rows: true}, "8/8/3b4/3bb3/3bw3/8/8/8 w"},
+		{SFENOptions{MoveCounter: true}, "19b7bb6bw27 w 2"},
+		{SFENOptions{Rows: true, MoveCounter: true}, "8/8/3b4/3bb3/3bw3/8/8/8 w 2"},
+	}
+	for _, tt := range tests {
+		if got := b.FormatSFEN(tt.opt); got != tt.want {
+			t.Errorf("FormatSFEN(%+v) = %q, want %q", tt.opt, got, tt.want)
+		}
+	}
+}
+
+// TestSFENRoundTrip writes every position of random games in all SFEN
+// forms and reads them back with ParseSFEN and NewBoardSFEN.
+func TestSFENRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	options := []SFENOptions{
+		{},
+		{Rows: true},
+		{MoveCounter: true},
+		{Rows: true, MoveCounter: true},
+	}
+	for _, boardlen := range []int{4, 8, 10, 26} {
+		b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+		for !b.IsGameOver() {
+			for _, opt := range options {
+				sfen := b.FormatSFEN(opt)
+				b2, err := ParseSFEN(boardlen, sfen)
+				if err != nil {
+					t.Fatalf("ParseSFEN(%d, %q) error: %v", boardlen, sfen, err)
+				}
+				if b2.ToSFEN() != b.ToSFEN() || b2.Hash() != b.Hash() {
+					t.Fatalf("ParseSFEN(%d, %q) = %s, want %s", boardlen, sfen, b2.ToSFEN(), b.ToSFEN())
+				}
+				if opt.MoveCounter && b2.MoveNumber() != b.MoveNumber() {
+					t.Fatalf("ParseSFEN(%d, %q) move number = %d, want %d", boardlen, sfen, b2.MoveNumber(), b.MoveNumber())
+				}
+				if opt.Rows {
+					if b3, err := ParseSFEN(0, sfen); err != nil || b3.Boardlen != boardlen {
+						t.Fatalf("ParseSFEN(0, %q) did not find board size %d: %v", sfen, boardlen, err)
+					}
+				}
+				if b4 := NewBoardSFEN(boardlen, sfen); b4.ToSFEN() != b.ToSFEN() {
+					t.Fatalf("NewBoardSFEN(%d, %q) = %s, want %s", boardlen, sfen, b4.ToSFEN(), b.ToSFEN())
+				}
+			}
+			mv := Position(-1)
+			if lms := b.LegalMoves(); len(lms) != 0 {
+				mv = lms[rng.Intn(len(lms))]
+			}
+			b.MoveUpdate(mv)
+		}
+	}
+}
+
+func TestIsLegalMoveOutOfRange(t *testing.T) {
+	for _, boardlen := range []int{6, 8, 10} {
+		b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+		for _, mv := range []Position{-2, -100, Position(boardlen*boardlen), 1000} {
+			if b.IsLegalMove(mv) {
+				t.Errorf("%dx%d: IsLegalMove(%d) = true", boardlen, boardlen, mv)
+			}
+		}
+	}
+}
+
+func TestAnalysisNaive(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	n_games := 4
+	if testing.Short() {
+		n_games = 1
+	}
+	for boardlen := 4; boardlen <= 26; boardlen += 2 {
+		for g := 0; g < n_games; g++ {
+			b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+			for !b.IsGameOver() {
+				nb := new_naive_board(b)
+				for color := Black; color <= White; color++ {
+					if got, want := b.Mobility(color), nb.mobility(color); got != want {
+						t.Fatalf("%s: Mobility(%d) = %d, naive = %d", b.ToSFEN(), color, got, want)
+					}
+					if got, want := b.FrontierDiscs(color), nb.frontier(color); !equal_squares(got, want) {
+						t.Fatalf("%s: FrontierDiscs(%d) = %v, naive = %v", b.ToSFEN(), color, got, want)
+					}
+					if got, want := b.StableDiscs(color), nb.stable(color); !equal_squares(got, want) {
+						t.Fatalf("%s: StableDiscs(%d) = %v, naive = %v", b.ToSFEN(), color, got, want)
+					}
+				}
+				mv := Position(-1)
+				if lms := b.LegalMoves(); len(lms) != 0 {
+					mv = lms[rng.Intn(len(lms))]
+				}
+				b.MoveUpdate(mv)
+			}
+		}
+	}
+}
+
+func TestStableDiscs(t *testing.T) {
+	tests := []struct {
+		sfen string
+		black int
+		white int
+	}{
+		{"8/8/8/3wb3/3bw3/8/8/8 b", 0, 0},
+		{"bbbw4/b7/8/3wb3/3bw3/8/8/8 b", 4, 0},
+		// a full inner row is not stable, a full edge is
+		{"8/8/8/bwbwbwbw/3bw3/8/8/8 b", 0, 0},
+		{"bwbwbwbb/8/8/3wb3/3bw3/8/8/8 b", 5, 3},
+	}
+	for _, tt := range tests {
+		b, err := ParseSFEN(8, tt.sfen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := b.CountBits(b.StableDiscs(Black)); n != tt.black {
+			t.Errorf("%s: %d stable black discs, want %d", tt.sfen, n, tt.black)
+		}
+		if n := b.CountBits(b.StableDiscs(White)); n != tt.white {
+			t.Errorf("%s: %d stable white discs, want %d", tt.sfen, n, tt.white)
+		}
+	}
+}
+
+func TestStr2Position(t *testing.T) {
+	for _, n := range []int{4, 8, 26} {
+		b := NewBoard(n)
+		for pos := Position(0); int(pos) < n*n; pos++ {
+			s := b.Position2Str(pos)
+			if got, err := b.Str2Position(s); err != nil || got != pos {
+				t.Errorf("%dx%d: Str2Position(%q) = %d, %v, want %d", n, n, s, got, err, pos)
+			}
+			if got, err := b.Str2Position(strings.ToUpper(s)); err != nil || got != pos {
+				t.Errorf("%dx%d: Str2Position(%q) = %d, %v, want %d", n, n, strings.ToUpper(s), got, err, pos)
+			}
+		}
+	}
+	b := NewBoard(8)
+	if pos, err := b.Str2Position("PASS"); err != nil || pos != -1 {
+		t.Errorf("Str2Position(PASS) = %d, %v", pos, err)
+	}
+	for _, s := range []string{"", "a", "5", "a0", "a9", "i1", "a01", "a+1", "a-1", "abc1", "a1x"} {
+		if pos, err := b.Str2Position(s); err == nil {
+			t.Errorf("Str2Position(%q) = %d, want an error", s, pos)
+		}
+	}
+}
+
+func equal_moves(x, y []Position) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// naive_board is a square-by-square reference implementation of the rules,
+// used to check the bitboard code.
+type naive_board struct {
+	boardlen int
+	turn int
+	squares []int // 0: empty 1: black 2: white
+}
+
+func new_naive_board(b *Board) *naive_board {
+	nb := &naive_board{
+		boardlen: b.Boardlen,
+		turn: b.Turn,
+		squares: make([]int, b.Boardlen*b.Boardlen),
+	}
+	for pos := range nb.squares {
+		if is_bit_on(b.black, pos) {
+			nb.squares[pos] = 1
+		} else if is_bit_on(b.white, pos) {
+			nb.squares[pos] = 2
+		}
+	}
+	return nb
+}
+
+func (nb *naive_board) duplicate() *naive_board {
+	nb2 := *nb
+	nb2.squares = append([]int{}, nb.squares...)
+	return &nb2
+}
+
+// flips returns the squares turned over if the side to move plays pos.
+func (nb *naive_board) flips(pos int) []int {
+	n := nb.boardlen
+	me := nb.turn + 1
+	if nb.squares[pos] != 0 {
+		return nil
+	}
+	var flips []int
+	x0, y0 := pos / n, pos % n
+	for dx := -1; dx <= 1; dx++ {
+		for dy := -1; dy <= 1; dy++ {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			var run []int
+			x, y := x0+dx, y0+dy
+			for 0 <= x && x < n && 0 <= y && y < n {
+				sq := nb.squares[x*n + y]
+				if sq == 0 {
+					run = nil
+					break
+				}
+				if sq == me {
+					break
+				}
+				run = append(run, x*n + y)
+				x, y = x+dx, y+dy
+			}
+			if !(0 <= x && x < n && 0 <= y && y < n) {
+				run = nil
+			}
+			flips = append(flips, run...)
+		}
+	}
+	return flips
+}
+
+func (nb *naive_board) legal_moves() []Position {
+	pms := []Position{}
+	for pos := range nb.squares {
+		if len(nb.flips(pos)) != 0 {
+			pms = append(pms, Position(pos))
+		}
+	}
+	return pms
+}
+
+func (nb *naive_board) is_game_over() bool {
+	if len(nb.legal_moves()) != 0 {
+		return false
+	}
+	nb.turn = 1 - nb.turn
+	over := len(nb.legal_moves()) == 0
+	nb.turn = 1 - nb.turn
+	return over
+}
+
+func (nb *naive_board) move(mv Position) {
+	if mv != -1 {
+		me := nb.turn + 1
+		for _, pos := range nb.flips(int(mv)) {
+			nb.squares[pos] = me
+		}
+		nb.squares[mv] = me
+	}
+	nb.turn = 1 - nb.turn
+}
+
+func (nb *naive_board) to_sfen() string {
+	b := NewBoard(nb.boardlen)
+	for pos, sq := range nb.squares {
+		if sq == 1 {
+			set_bit(b.black, pos)
+		} else if sq == 2 {
+			set_bit(b.white, pos)
+		}
+	}
+	b.Turn = nb.turn
+	return b.ToSFEN()
+}
+
+// equal_squares compares a bitboard with a list of squares.
+func equal_squares(bits BitMap, squares []int) bool {
+	n := 0
+	for pos := 0; pos < len(bits)*INTSIZE; pos++ {
+		if is_bit_on(bits, pos) {
+			if n == len(squares) || squares[n] != pos {
+				return false
+			}
+			n++
+		}
+	}
+	return n == len(squares)
+}
+
+func (nb *naive_board) mobility(color int) int {
+	nb2 := nb.duplicate()
+	nb2.turn = color
+	return len(nb2.legal_moves())
+}
+
+func (nb *naive_board) inside(x int, y int) bool {
+	return x >= 0 && y >= 0 && x < nb.boardlen && y < nb.boardlen
+}
+
+func (nb *naive_board) frontier(color int) []int {
+	n := nb.boardlen
+	var squares []int
+	for pos, sq := range nb.squares {
+		if sq != color+1 {
+			continue
+		}
+		x, y := pos / n, pos % n
+	next:
+		for dx := -1; dx <= 1; dx++ {
+			for dy := -1; dy <= 1; dy++ {
+				if nb.inside(x+dx, y+dy) && nb.squares[(x+dx)*n + y+dy] == 0 {
+					squares = append(squares, pos)
+					break next
+				}
+			}
+		}
+	}
+	return squares
+}
+
+// stable follows the definition of Board.StableDiscs square by square.
+func (nb *naive_board) stable(color int) []int {
+	n := nb.boardlen
+	axes := [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}}
+	full := func(x int, y int, dx int, dy int) bool {
+		for x, y := x, y; nb.inside(x, y); x, y = x+dx, y+dy {
+			if nb.squares[x*n + y] == 0 {
+				return false
+			}
+		}
+		for x, y := x, y; nb.inside(x, y); x, y = x-dx, y-dy {
+			if nb.squares[x*n + y] == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	stable := make([]bool, n*n)
+	anchored := func(x int, y int) bool {
+		return !nb.inside(x, y) || nb.squares[x*n + y] == color+1 && stable[x*n + y]
+	}
+	for changed := true; changed; {
+		changed = false
+		for pos, sq := range nb.squares {
+			if sq != color+1 || stable[pos] {
+				continue
+			}
+			x, y := pos / n, pos % n
+			ok := true
+			for _, a := range axes {
+				dx, dy := a[0], a[1]
+				if !anchored(x+dx, y+dy) && !anchored(x-dx, y-dy) && !full(x, y, dx, dy) {
+					ok = false
+					break
+				}
+			}
+			if ok {
+				stable[pos] = true
+				changed = true
+			}
+		}
+	}
+	var squares []int
+	for pos := range stable {
+		if stable[pos] {
+			squares = append(squares, pos)
+		}
+	}
+	return squares
+}
+
+func naive_perft(nb *naive_board, depth int) int64 {
+	if depth == 0 {
+		return 1
+	}
+	lms := nb.legal_moves()
+	if len(lms) == 0 {
+		if nb.is_game_over() {
+			return 1
+		}
+		nb2 := nb.duplicate()
+		nb2.move(-1)
+		return naive_perft(nb2, depth-1)
+	}
+	var nodes int64
+	for _, mv := range lms {
+		nb2 := nb.duplicate()
+		nb2.move(mv)
+		nodes += naive_perft(nb2, depth-1)
+	}
+	return nodes
+}
+
+// Benchmarks for the move generator. Run with
+//   go test -bench . -benchmem
+// The SHL/SHLInto pair shows the cost of the allocating BitMap operations
+// that the move generator used to be built from.
+
+func benchmark_playout(bn *testing.B, boardlen int) {
+	rng := rand.New(rand.NewSource(1))
+	initial := MakeInitialSFEN(boardlen)
+	b := NewBoardSFEN(boardlen, initial)
+	nodes := 0
+	bn.ReportAllocs()
+	bn.ResetTimer()
+	for i := 0; i < bn.N; i++ {
+		if b.IsGameOver() {
+			b = NewBoardSFEN(boardlen, initial)
+		}
+		mv := Position(-1)
+		if lms := b.LegalMoves(); len(lms) != 0 {
+			mv = lms[rng.Intn(len(lms))]
+		}
+		b.MoveUpdate(mv)
+		nodes++
+	}
+	bn.ReportMetric(float64(nodes)/bn.Elapsed().Seconds(), "nodes/s")
+}
+
+func BenchmarkPlayout8(bn *testing.B)  { benchmark_playout(bn, 8) }
+func BenchmarkPlayout16(bn *testing.B) { benchmark_playout(bn, 16) }
+func BenchmarkPlayout26(bn *testing.B) { benchmark_playout(bn, 26) }
+
+func benchmark_legal_moves(bn *testing.B, boardlen int) {
+	b := NewBoardSFEN(boardlen, MakeInitialSFEN(boardlen))
+	dst := make(BitMap, b.bitmapsz, b.bitmapsz)
+	bn.ReportAllocs()
+	bn.ResetTimer()
+	for i := 0; i < bn.N; i++ {
+		b.legal_moves_into(dst, b.black, b.white)
+	}
+}
+
+func BenchmarkLegalMoves16(bn *testing.B) { benchmark_legal_moves(bn, 16) }
+func BenchmarkLegalMoves26(bn *testing.B) { benchmark_legal_moves(bn, 26) }
+
+func BenchmarkSHL26(bn *testing.B) {
+	b := NewBoardSFEN(26, MakeInitialSFEN(26))
+	bn.ReportAllocs()
+	for i := 0; i < bn.N; i++ {
+		b.SHL(b.black, 27)
+	}
+}
+
+func BenchmarkSHLInto26(bn *testing.B) {
+	b := NewBoardSFEN(26, MakeInitialSFEN(26))
+	dst := make(BitMap, b.bitmapsz, b.bitmapsz)
+	bn.ReportAllocs()
+	for i := 0; i < bn.N; i++ {
+		b.SHLInto(dst, b.black, 27)
+	}
+}
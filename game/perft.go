@@ -0,0 +1,31 @@
+package game
+
+// Perft counts the leaf nodes of the game tree below b at the given depth.
+// A pass is a move of its own when the side to move has no legal move but
+// the opponent has. A finished game counts as a single leaf even when it
+// ends above depth. Perft is meant for verifying move generation.
+func Perft(b *Board, depth int) int64 {
+	if depth == 0 {
+		return 1
+	}
+	lms := b.LegalMoves()
+	if len(lms) == 0 {
+		if b.IsGameOver() {
+			return 1
+		}
+		u := b.MoveUpdate(-1)
+		nodes := Perft(b, depth-1)
+		b.Undo(u)
+		return nodes
+	}
+	if depth == 1 {
+		return int64(len(lms))
+	}
+	var nodes int64
+	for _, mv := range lms {
+		u := b.MoveUpdate(mv)
+		nodes += Perft(b, depth-1)
+		b.Undo(u)
+	}
+	return nodes
+}
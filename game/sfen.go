@@ -0,0 +1,150 @@
+package game
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SFENOptions selects the optional parts of the SFEN written by FormatSFEN.
+type SFENOptions struct {
+	Rows bool // put a '/' between every two rows, like chess FEN
+	MoveCounter bool // append the move number, see Board.MoveNumber
+}
+
+// FormatSFEN writes b as SFEN. ToSFEN is FormatSFEN with no options, the
+// form used in the protocol.
+func (b *Board) FormatSFEN(opt SFENOptions) string {
+	var sfen strings.Builder
+	space_count := 0
+	for pos := 0; pos < b.Boardlen*b.Boardlen; pos++ {
+		if opt.Rows && pos != 0 && pos % b.Boardlen == 0 {
+			if space_count != 0 {
+				sfen.WriteString(strconv.Itoa(space_count))
+				space_count = 0
+			}
+			sfen.WriteByte('/')
+		}
+		if is_bit_on(b.black, pos) {
+			if space_count != 0 {
+				sfen.WriteString(strconv.Itoa(space_count))
+				space_count = 0
+			}
+			sfen.WriteByte('b')
+		} else if is_bit_on(b.white, pos) {
+			if space_count != 0 {
+				sfen.WriteString(strconv.Itoa(space_count))
+				space_count = 0
+			}
+			sfen.WriteByte('w')
+		} else {
+			space_count++
+		}
+	}
+	if space_count != 0 {
+		sfen.WriteString(strconv.Itoa(space_count))
+	}
+	if b.IsBlackTurn() {
+		sfen.WriteString(" b")
+	} else {
+		sfen.WriteString(" w")
+	}
+	if opt.MoveCounter {
+		sfen.WriteString(" " + strconv.Itoa(b.MoveNumber()))
+	}
+	return sfen.String()
+}
+
+// ParseSFEN is the strict counterpart of NewBoardSFEN. The board field is a
+// run-length string of 'b', 'w' and empty-square counts, optionally with a
+// '/' between every two rows, followed by the side to move, "b" or "w", and
+// an optional move counter. Malformed input is reported as an error instead
+// of being skipped. With boardlen 0 the board size is taken from the rows.
+func ParseSFEN(boardlen int, sfen string) (*Board, error) {
+	fields := strings.Fields(sfen)
+	if len(fields) != 2 && len(fields) != 3 {
+		return nil, fmt.Errorf("sfen %q: want board, side to move and optional move counter, got %d fields", sfen, len(fields))
+	}
+	n_rows := strings.Count(fields[0], "/")
+	if boardlen == 0 && n_rows != 0 {
+		boardlen = n_rows + 1
+	}
+	if boardlen < 1 {
+		return nil, fmt.Errorf("sfen %q: invalid board size %d", sfen, boardlen)
+	}
+	if n_rows != 0 && n_rows != boardlen-1 {
+		return nil, fmt.Errorf("sfen %q: %d row separators, want %d", sfen, n_rows, boardlen-1)
+	}
+	b := NewBoard(boardlen)
+	n_squares := boardlen*boardlen
+
+	board := fields[0]
+	pos := 0
+	disc_count := 0
+	last_row := 0 // position of the last '/'
+	for i := 0; i < len(board); {
+		c := board[i]
+		if IsDigit(c) {
+			j := i+1
+			for j < len(board) && IsDigit(board[j]) {
+				j++
+			}
+			num, err := strconv.Atoi(board[i:j])
+			if err != nil || num == 0 || c == byte('0') {
+				return nil, fmt.Errorf("sfen %q: bad empty-square count %q at offset %d", sfen, board[i:j], i)
+			}
+			if pos + num > n_squares {
+				return nil, fmt.Errorf("sfen %q: count %d at offset %d runs past the end of the board", sfen, num, i)
+			}
+			if n_rows != 0 && pos / boardlen != (pos + num - 1) / boardlen {
+				return nil, fmt.Errorf("sfen %q: count %d at offset %d runs across a row", sfen, num, i)
+			}
+			pos += num
+			i = j
+			continue
+		}
+		switch c {
+		case byte('b'), byte('w'):
+			if pos >= n_squares {
+				return nil, fmt.Errorf("sfen %q: disc at offset %d is past the end of the board", sfen, i)
+			}
+			if c == byte('b') {
+				set_bit(b.black, pos)
+			} else {
+				set_bit(b.white, pos)
+			}
+			pos += 1
+			disc_count += 1
+		case byte('/'):
+			if pos == last_row || pos % boardlen != 0 || pos == n_squares {
+				return nil, fmt.Errorf("sfen %q: row separator at offset %d is not at the end of a row", sfen, i)
+			}
+			last_row = pos
+		default:
+			return nil, fmt.Errorf("sfen %q: unknown character %q at offset %d", sfen, c, i)
+		}
+		i++
+	}
+	if pos != n_squares {
+		return nil, fmt.Errorf("sfen %q: board has %d squares, want %d", sfen, pos, n_squares)
+	}
+
+	switch fields[1] {
+	case "b":
+		b.Turn = 0
+	case "w":
+		b.Turn = 1
+	default:
+		return nil, fmt.Errorf("sfen %q: bad side to move %q, want \"b\" or \"w\"", sfen, fields[1])
+	}
+	if len(fields) == 3 {
+		num, err := strconv.Atoi(fields[2])
+		if err != nil || num < 1 {
+			return nil, fmt.Errorf("sfen %q: bad move counter %q", sfen, fields[2])
+		}
+		b.ply = num - 1
+	}
+	b.discs = disc_count
+	b.hash = b.compute_hash()
+	return b, nil
+}
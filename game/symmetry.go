@@ -0,0 +1,106 @@
+package game
+
+// Symmetry is one of the 8 symmetries of a square board. A position is
+// x*Boardlen + y where x is the row and y the column, as in PrintBoard.
+type Symmetry int
+
+const (
+	Identity Symmetry = iota
+	Rotate90 // clockwise
+	Rotate180
+	Rotate270
+	FlipHorizontal // mirror the columns
+	FlipVertical // mirror the rows
+	FlipDiagonal // transpose, a1 stays in place
+	FlipAntiDiagonal
+)
+
+const NumSymmetries = 8
+
+// Inverse returns the symmetry that undoes s.
+func (s Symmetry) Inverse() Symmetry {
+	if s == Rotate90 {
+		return Rotate270
+	} else if s == Rotate270 {
+		return Rotate90
+	}
+	return s
+}
+
+// TransformPosition maps pos on a boardlen x boardlen board through sym.
+// A pass (-1) stays a pass.
+func TransformPosition(boardlen int, pos Position, sym Symmetry) Position {
+	if pos == -1 {
+		return pos
+	}
+	m := boardlen - 1
+	x, y := int(pos) / boardlen, int(pos) % boardlen
+	switch sym {
+	case Rotate90:
+		x, y = y, m-x
+	case Rotate180:
+		x, y = m-x, m-y
+	case Rotate270:
+		x, y = m-y, x
+	case FlipHorizontal:
+		y = m-y
+	case FlipVertical:
+		x = m-x
+	case FlipDiagonal:
+		x, y = y, x
+	case FlipAntiDiagonal:
+		x, y = m-y, m-x
+	}
+	return Position(x*boardlen + y)
+}
+
+// Transform returns a new board with the discs of b mapped through sym.
+// The side to move is unchanged.
+func (b *Board) Transform(sym Symmetry) *Board {
+	b2 := b.duplicate()
+	for i := 0; i < b.bitmapsz; i++ {
+		b2.black[i] = 0
+		b2.white[i] = 0
+	}
+	for pos := 0; pos < b.Boardlen*b.Boardlen; pos++ {
+		if is_bit_on(b.black, pos) {
+			set_bit(b2.black, int(TransformPosition(b.Boardlen, Position(pos), sym)))
+		} else if is_bit_on(b.white, pos) {
+			set_bit(b2.white, int(TransformPosition(b.Boardlen, Position(pos), sym)))
+		}
+	}
+	b2.hash = b2.compute_hash()
+	return b2
+}
+
+// Canonical returns the representative of the 8 symmetric variants of b
+// together with the symmetry that maps b onto it. Equivalent positions
+// have the same canonical board, and so the same ToSFEN and Hash.
+// Moves found for the canonical board map back with sym.Inverse().
+func (b *Board) Canonical() (*Board, Symmetry) {
+	best := b.duplicate()
+	best_sym := Identity
+	for sym := Rotate90; sym < NumSymmetries; sym++ {
+		b2 := b.Transform(sym)
+		if b2.less(best) {
+			best = b2
+			best_sym = sym
+		}
+	}
+	return best, best_sym
+}
+
+// less orders boards by their black discs, then by their white discs.
+func (b *Board) less(b2 *Board) bool {
+	for i := 0; i < b.bitmapsz; i++ {
+		if b.black[i] != b2.black[i] {
+			return b.black[i] < b2.black[i]
+		}
+	}
+	for i := 0; i < b.bitmapsz; i++ {
+		if b.white[i] != b2.white[i] {
+			return b.white[i] < b2.white[i]
+		}
+	}
+	return false
+}
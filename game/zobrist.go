@@ -0,0 +1,100 @@
+package game
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Zobrist hashing.
+// Every square has a random key per color and the side to move has one
+// more. The hash of a position is the xor of the keys of its discs, plus
+// the turn key when white is to move. The keys are generated from a fixed
+// seed per board size, so hashes are stable across runs and processes and
+// can be stored in databases.
+
+type zobrist struct {
+	black []uint64
+	white []uint64
+	flip []uint64 // black ^ white, for discs changing color
+	turn uint64
+}
+
+var (
+	zobrist_tables = map[int]*zobrist{}
+	zobrist_mu sync.Mutex
+)
+
+// splitmix64 is used instead of math/rand so that the keys never depend
+// on the Go release.
+func splitmix64(state *uint64) uint64 {
+	*state += 0x9e37_79b9_7f4a_7c15
+	z := *state
+	z = (z ^ (z >> 30)) * 0xbf58_476d_1ce4_e5b9
+	z = (z ^ (z >> 27)) * 0x94d0_49bb_1331_11eb
+	return z ^ (z >> 31)
+}
+
+func zobrist_table(boardlen int) *zobrist {
+	zobrist_mu.Lock()
+	defer zobrist_mu.Unlock()
+	if z, ok := zobrist_tables[boardlen]; ok {
+		return z
+	}
+	n := boardlen*boardlen
+	z := &zobrist{
+		black: make([]uint64, n, n),
+		white: make([]uint64, n, n),
+		flip: make([]uint64, n, n),
+	}
+	state := uint64(boardlen)
+	for pos := 0; pos < n; pos++ {
+		z.black[pos] = splitmix64(&state)
+		z.white[pos] = splitmix64(&state)
+		z.flip[pos] = z.black[pos] ^ z.white[pos]
+	}
+	z.turn = splitmix64(&state)
+	zobrist_tables[boardlen] = z
+	return z
+}
+
+// Hash returns the Zobrist hash of the position including the side to move.
+func (b *Board) Hash() uint64 {
+	if b.Turn == 0 {
+		return b.hash
+	}
+	return b.hash ^ b.zobrist.turn
+}
+
+// compute_hash computes the disc part of the hash from scratch.
+func (b *Board) compute_hash() uint64 {
+	var h uint64
+	for pos := 0; pos < b.Boardlen*b.Boardlen; pos++ {
+		if is_bit_on(b.black, pos) {
+			h ^= b.zobrist.black[pos]
+		} else if is_bit_on(b.white, pos) {
+			h ^= b.zobrist.white[pos]
+		}
+	}
+	return h
+}
+
+// update_hash accounts for mv played by color turn flipping the discs
+// in flipped.
+func (b *Board) update_hash(mv Position, turn int, flipped BitMap) {
+	if turn == 0 {
+		b.hash ^= b.zobrist.black[mv]
+	} else {
+		b.hash ^= b.zobrist.white[mv]
+	}
+	for x := 0; x < b.bitmapsz; x++ {
+		b.update_hash_word(x, flipped[x])
+	}
+}
+
+func (b *Board) update_hash_word(x int, w uint64) {
+	for w != 0 {
+		y := bits.LeadingZeros64(w)
+		b.hash ^= b.zobrist.flip[x*INTSIZE + y]
+		w &^= uint64(0x8000_0000_0000_0000) >> y
+	}
+}
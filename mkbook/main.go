@@ -0,0 +1,81 @@
+// mkbook builds an opening book (see package book) from recorded games.
+//
+// Each input line is one game, in a format read by package records;
+// transcripts of moves are 8x8 games. Games that were not played to the end
+// are skipped.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"book"
+	"game"
+	"records"
+)
+
+func add_game(bk *book.Book, b *game.Board, strs []string) error {
+	var moves []game.Position
+	for _, s := range strs {
+		mv, err := b.Str2Position(s)
+		if err != nil {
+			return err
+		}
+		moves = append(moves, mv)
+	}
+	return bk.AddGame(b, moves)
+}
+
+func read_games(bk *book.Book, r io.Reader, name string) error {
+	return records.Read(r, name, 0, func(b *game.Board, moves []string) error {
+		return add_game(bk, b, moves)
+	})
+}
+
+func main() {
+	out := flag.String("out", "book.json", "book file to write")
+	depth := flag.Int("depth", book.DefaultDepth, "moves of each game to store")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [game files]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	bk := book.NewBook(*depth)
+	if flag.NArg() == 0 {
+		if err := read_games(bk, os.Stdin, "stdin"); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = read_games(bk, f, name)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+	}
+	log.Println("positions =", bk.Positions())
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	if err = bk.Write(w); err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", *out, err)
+	}
+}
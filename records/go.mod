@@ -0,0 +1,7 @@
+module records
+
+go 1.18
+
+replace game => ../game
+
+require game v0.0.0-00010101000000-000000000000
@@ -0,0 +1,91 @@
+// Package records reads the game records that the tools learn from.
+//
+// Each line is one game: either a GameMessage document as stored by the
+// server (mongoexport writes one per line), or a transcript of moves such
+// as "f5d6c3" or "f5 d6 c3".
+package records
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+
+	"game"
+)
+
+// the fields of the server's GameMessage that make up the game
+type game_message struct {
+	Gameid        string
+	StartPosition string
+	StartMoves    []string
+	Moves         []string
+	BoardSize     int
+}
+
+var move_re = regexp.MustCompile(`(?i)pass|[a-z][0-9]+`)
+
+// Parse returns the start position and the moves of a game record. With
+// boardlen 0 games of any size are accepted and transcripts are 8x8,
+// otherwise games of other sizes are errors.
+func Parse(line string, boardlen int) (*game.Board, []string, error) {
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, "{") {
+		moves := move_re.FindAllString(line, -1)
+		if strings.Join(moves, "") != strings.Join(strings.Fields(line), "") {
+			return nil, nil, errors.New("not a move transcript")
+		}
+		if boardlen == 0 {
+			boardlen = 8
+		}
+		return game.NewBoardSFEN(boardlen, game.MakeInitialSFEN(boardlen)), moves, nil
+	}
+	var gm game_message
+	if err := json.Unmarshal([]byte(line), &gm); err != nil {
+		return nil, nil, err
+	}
+	if gm.BoardSize < 4 {
+		return nil, nil, fmt.Errorf("game %s: bad board size %d", gm.Gameid, gm.BoardSize)
+	}
+	if boardlen != 0 && gm.BoardSize != boardlen {
+		return nil, nil, fmt.Errorf("game %s: %dx%d board", gm.Gameid, gm.BoardSize, gm.BoardSize)
+	}
+	b := game.NewBoardSFEN(gm.BoardSize, game.MakeInitialSFEN(gm.BoardSize))
+	if gm.StartPosition != "" {
+		var err error
+		if b, err = game.ParseSFEN(gm.BoardSize, gm.StartPosition); err != nil {
+			return nil, nil, err
+		}
+	}
+	return b, append(gm.StartMoves, gm.Moves...), nil
+}
+
+// Read parses every game of r as Parse does and passes it to add. Games
+// that Parse or add reject are logged and skipped; name is the file name
+// for the log.
+func Read(r io.Reader, name string, boardlen int, add func(start *game.Board, moves []string) error) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	n_games, n_skipped := 0, 0
+	for ln := 1; sc.Scan(); ln++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		b, moves, err := Parse(sc.Text(), boardlen)
+		if err == nil {
+			err = add(b, moves)
+		}
+		if err != nil {
+			n_skipped++
+			log.Printf("%s:%d: skipped: %v", name, ln, err)
+			continue
+		}
+		n_games++
+	}
+	log.Printf("%s: %d games, %d skipped", name, n_games, n_skipped)
+	return sc.Err()
+}
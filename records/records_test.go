@@ -0,0 +1,57 @@
+package records
+
+import (
+	"strings"
+	"testing"
+
+	"game"
+)
+
+func TestParse(t *testing.T) {
+	initial8 := game.MakeInitialSFEN(8)
+	tests := []struct {
+		line string
+		boardlen int
+		sfen string // of the start position, "" for an error
+		moves string
+	}{
+		{"f5d6c3", 0, initial8, "f5 d6 c3"},
+		{" f5 d6 PASS ", 8, initial8, "f5 d6 PASS"},
+		{"f5 hello", 0, "", ""},
+		{`{"Gameid":"g","BoardSize":6,"Moves":["b3","c2"]}`, 0, game.MakeInitialSFEN(6), "b3 c2"},
+		{`{"Gameid":"g","BoardSize":6,"Moves":["b3"]}`, 8, "", ""},
+		{`{"Gameid":"g","BoardSize":2,"Moves":[]}`, 0, "", ""},
+		{`{"Gameid":"g","BoardSize":8,"StartPosition":"8/8/8/3wb3/3bw3/8/8/8 b 1","StartMoves":["f5"],"Moves":["d6"]}`,
+			8, initial8, "f5 d6"},
+		{`{"Gameid":`, 0, "", ""},
+	}
+	for _, tt := range tests {
+		b, moves, err := Parse(tt.line, tt.boardlen)
+		if tt.sfen == "" {
+			if err == nil {
+				t.Errorf("%q: no error", tt.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		want := game.NewBoardSFEN(b.Boardlen, tt.sfen)
+		if b.ToSFEN() != want.ToSFEN() || strings.Join(moves, " ") != tt.moves {
+			t.Errorf("%q: %s %v, want %s %s", tt.line, b.ToSFEN(), moves, want.ToSFEN(), tt.moves)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	in := "f5d6c3\n\nnot a game\n" + `{"Gameid":"g","BoardSize":6,"Moves":["b3"]}` + "\n"
+	n := 0
+	err := Read(strings.NewReader(in), "test", 8, func(b *game.Board, moves []string) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("read %d games, err %v, want 1", n, err)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"game"
+)
+
+// clock modes
+const (
+	clock_move = "move" // every move within the per-move timeout
+	clock_fischer = "fischer" // a time bank, plus an increment after each move
+	clock_byoyomi = "byoyomi" // a time bank, then a fixed time for each move
+)
+
+// TimeControl is the time limit of the games.
+type TimeControl struct {
+	Mode string
+	Move time.Duration // per-move timeout of clock_move
+	Main time.Duration // time bank of each player
+	Increment time.Duration // of clock_fischer
+	Byoyomi time.Duration // of clock_byoyomi
+}
+
+func (tc TimeControl) check() error {
+	switch tc.Mode {
+	case clock_move:
+		if tc.Move <= 0 {
+			return fmt.Errorf("per-move timeout %v", tc.Move)
+		}
+	case clock_fischer:
+		if tc.Main <= 0 {
+			return fmt.Errorf("time bank %v", tc.Main)
+		}
+	case clock_byoyomi:
+		if tc.Main < 0 || tc.Byoyomi <= 0 {
+			return fmt.Errorf("time bank %v with byo-yomi %v", tc.Main, tc.Byoyomi)
+		}
+	default:
+		return fmt.Errorf("unknown clock mode %q", tc.Mode)
+	}
+	return nil
+}
+
+// Clock is the time left to both players of a game, indexed by color.
+type Clock struct {
+	tc TimeControl
+	remaining [2]time.Duration // of the time bank
+}
+
+func new_clock(tc TimeControl) *Clock {
+	return &Clock{
+		tc: tc,
+		remaining: [2]time.Duration{tc.Main, tc.Main},
+	}
+}
+
+// limit returns the time color has for its next move.
+func (c *Clock) limit(color int) time.Duration {
+	switch c.tc.Mode {
+	case clock_fischer:
+		return c.remaining[color]
+	case clock_byoyomi:
+		return c.remaining[color] + c.tc.Byoyomi
+	}
+	return c.tc.Move
+}
+
+// spend charges color for a move that took elapsed and returns false if
+// it ran out of time.
+func (c *Clock) spend(color int, elapsed time.Duration) bool {
+	if elapsed > c.limit(color) {
+		if c.tc.Mode != clock_move {
+			c.remaining[color] = 0
+		}
+		return false
+	}
+	switch c.tc.Mode {
+	case clock_fischer:
+		c.remaining[color] += c.tc.Increment - elapsed
+	case clock_byoyomi:
+		// moves within byo-yomi do not touch the empty bank
+		c.remaining[color] -= elapsed
+		if c.remaining[color] < 0 {
+			c.remaining[color] = 0
+		}
+	}
+	return true
+}
+
+func msec(d time.Duration) int {
+	return int(d / time.Millisecond)
+}
+
+// fill_clock sets the clock fields of a PLAY or RESULT message.
+func (c *Clock) fill_clock(m *GameMessage) {
+	m.Clock = c.tc.Mode
+	if c.tc.Mode == clock_move {
+		return
+	}
+	m.BlackTime = msec(c.remaining[game.Black])
+	m.WhiteTime = msec(c.remaining[game.White])
+	if c.tc.Mode == clock_fischer {
+		m.Increment = msec(c.tc.Increment)
+	} else {
+		m.Byoyomi = msec(c.tc.Byoyomi)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"game"
+)
+
+func TestClock(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		name string
+		tc TimeControl
+		moves []time.Duration // by black
+		ok bool // of the last move
+		remaining time.Duration // of black after the moves
+		limit time.Duration // for the next move of black
+	}{
+		{"increment", TimeControl{Mode: clock_fischer, Main: 10*s, Increment: 2*s},
+			[]time.Duration{3*s, 1*s}, true, 10*s, 10*s},
+		{"fischer timeout", TimeControl{Mode: clock_fischer, Main: 10*s, Increment: 2*s},
+			[]time.Duration{3*s, 10*s}, false, 0, 0},
+		{"byoyomi empties bank", TimeControl{Mode: clock_byoyomi, Main: 2*s, Byoyomi: 5*s},
+			[]time.Duration{4*s}, true, 0, 5*s},
+		{"within bank", TimeControl{Mode: clock_byoyomi, Main: 10*s, Byoyomi: 5*s},
+			[]time.Duration{4*s}, true, 6*s, 11*s},
+		{"byoyomi timeout", TimeControl{Mode: clock_byoyomi, Main: 2*s, Byoyomi: 5*s},
+			[]time.Duration{4*s, 6*s}, false, 0, 5*s},
+		{"per move", TimeControl{Mode: clock_move, Move: 5*s, Main: 7*s},
+			[]time.Duration{3*s, 4*s}, true, 7*s, 5*s},
+		{"per move timeout", TimeControl{Mode: clock_move, Move: 5*s, Main: 7*s},
+			[]time.Duration{6*s}, false, 7*s, 5*s},
+	}
+	for _, tt := range tests {
+		c := new_clock(tt.tc)
+		ok := true
+		for _, d := range tt.moves {
+			ok = c.spend(game.Black, d)
+		}
+		if ok != tt.ok || c.remaining[game.Black] != tt.remaining || c.limit(game.Black) != tt.limit {
+			t.Errorf("%s: ok %v, remaining %v, limit %v; want %v, %v, %v", tt.name,
+				ok, c.remaining[game.Black], c.limit(game.Black), tt.ok, tt.remaining, tt.limit)
+		}
+		if c.remaining[game.White] != tt.tc.Main {
+			t.Errorf("%s: white has %v left without moving", tt.name, c.remaining[game.White])
+		}
+	}
+}
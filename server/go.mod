@@ -4,9 +4,13 @@ go 1.18
 
 replace game => ../game
 
+replace book => ../book
+
 require (
+	book v0.0.0-00010101000000-000000000000
 	game v0.0.0-00010101000000-000000000000
 	go.mongodb.org/mongo-driver v1.9.1
+	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f
 )
 
 require (
@@ -22,7 +26,6 @@ require (
 	github.com/xdg-go/scram v1.0.2 // indirect
 	github.com/xdg-go/stringprep v1.0.2 // indirect
 	github.com/youmark/pkcs8 v0.0.0-20181117223130-1be2e3e5546d // indirect
-	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f // indirect
 	golang.org/x/exp v0.0.0-20220518171630-0b5c67f07fdf // indirect
 	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e // indirect
 	golang.org/x/text v0.3.5 // indirect
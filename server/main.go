@@ -10,7 +10,6 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math"
 	"math/rand"
 	"net"
 	"os"
@@ -99,10 +98,14 @@ type User struct {
 	Remote_addr string
 	State       UserState
 	Statistics  *UserStatistics
+	resume      chan net.Conn // while waiting to log in again, under Lobby.mu
+	pending     net.Conn // logged in again before the game noticed, under Lobby.mu
 }
 
 type UserStatistics struct {
 	rating float64
+	rd float64
+	volatility float64
 	n_win int
 	n_loss int
 	n_draw int
@@ -118,17 +121,24 @@ type Database struct {
 type Lobby struct {
 	queue map[string]*User
 	mu    sync.Mutex
+	grace time.Duration // for users who lost their connection in a game to log in again
 }
 
-func create_user(userid string, conn net.Conn) *User {
-	ustat := &UserStatistics{
-		rating: 1500.0,
+func new_statistics() *UserStatistics {
+	return &UserStatistics{
+		rating: initial_rating.Rating,
+		rd: initial_rating.RD,
+		volatility: initial_rating.Volatility,
 		n_win: 0,
 		n_loss: 0,
 		n_draw: 0,
 		n_illegalmove: 0,
 		n_timeout: 0,
 	}
+}
+
+func create_user(userid string, conn net.Conn) *User {
+	ustat := new_statistics()
 	u := User{
 		Userid:      userid,
 		Conn:        conn,
@@ -147,9 +157,83 @@ func main() {
 	addr := flag.String("addr", ":19714", "server IP address:port")
 	boardlen := flag.Int("boardlen", 8, "reversi board side length")
 	timeout_msec := flag.Int("timeout", 10000, "timeout in msec")
+	clock := flag.String("clock", clock_move, "time control: move (-timeout per move), fischer (-main_time plus -increment per move) or byoyomi (-main_time, then -byoyomi per move)")
+	main_msec := flag.Int("main_time", 300000, "time bank of each player in msec")
+	increment_msec := flag.Int("increment", 0, "fischer increment in msec")
+	byoyomi_msec := flag.Int("byoyomi", 10000, "byo-yomi in msec")
 	dbuse := flag.Bool("db", false, "use database to store game info")
+	openings_file := flag.String("openings", "", "file of openings, SFEN positions or move sequences, one per line")
+	book_file := flag.String("book", "", "opening book to draw random balanced openings from")
+	book_plies := flag.Int("book_plies", 8, "moves of the openings drawn from the book")
+	rating := flag.String("rating", "elo", "rating system: elo or glicko2")
+	users_file := flag.String("users", "users.json", "user accounts file")
+	stats_file := flag.String("statistics", "statistics.json", "ratings and statistics of the users")
+	registration := flag.Bool("registration", true, "new users may register with a REGISTER message")
+	disable := flag.String("disable", "", "disable the account of this userid and exit, preferably with no server running")
+	enable := flag.String("enable", "", "enable the account of this userid and exit, preferably with no server running")
+	grace_msec := flag.Int("grace", 30000, "msec for a user who lost its connection in a game to log in again and resume it")
+	paired := flag.Bool("paired", false, "matched users play two games with colors swapped, rated as a pair")
 	flag.Parse()
 
+	tc := TimeControl{
+		Mode: *clock,
+		Move: time.Duration(*timeout_msec) * time.Millisecond,
+		Main: time.Duration(*main_msec) * time.Millisecond,
+		Increment: time.Duration(*increment_msec) * time.Millisecond,
+		Byoyomi: time.Duration(*byoyomi_msec) * time.Millisecond,
+	}
+	if err := tc.check(); err != nil {
+		log.Println("time control err =", err)
+		return
+	}
+
+	rs, err := new_rating_system(*rating)
+	if err != nil {
+		log.Println("rating err =", err)
+		return
+	}
+
+	store, err := open_user_store(*users_file)
+	if err != nil {
+		log.Println("user store err =", err)
+		return
+	}
+	stats_store, err := open_statistics_store(*stats_file)
+	if err != nil {
+		log.Println("statistics store err =", err)
+		return
+	}
+	// a running server rereads the file at the next login, but a
+	// registration saved at the same moment may undo the change, so these
+	// are best run while the server is stopped
+	if *disable != "" || *enable != "" {
+		if *disable != "" {
+			err = store.SetDisabled(*disable, true)
+		} else {
+			err = store.SetDisabled(*enable, false)
+		}
+		if err != nil {
+			log.Println("account err =", err)
+		}
+		return
+	}
+
+	// with openings, every pairing plays a random opening with both
+	// color assignments
+	var openings *OpeningSet
+	if *openings_file != "" && *book_file != "" {
+		log.Println("-openings and -book are exclusive")
+		return
+	} else if *openings_file != "" {
+		openings, err = load_openings(*openings_file, *boardlen)
+	} else if *book_file != "" {
+		openings, err = load_book_openings(*book_file, *boardlen, *book_plies)
+	}
+	if err != nil {
+		log.Println("openings err =", err)
+		return
+	}
+
 	ln, err := net.Listen("tcp", *addr)
 	if err != nil {
 		log.Println("Listen error ln =", ln, " err =", err)
@@ -158,6 +242,7 @@ func main() {
 
 	lobby := &Lobby{
 		queue: make(map[string]*User),
+		grace: time.Duration(*grace_msec) * time.Millisecond,
 	}
 
 	var db *Database = nil
@@ -208,7 +293,7 @@ func main() {
 				time.Sleep(time.Duration(10) * time.Second)
 				continue
 			}
-			user, err := do_login_add_to_lobby(conn, mylobby)
+			user, err := do_login_add_to_lobby(conn, mylobby, store, stats_store, *registration)
 			if err != nil {
 				log.Println("login failed userid =", user.Userid,
 					" RemoteAddr =", user.Remote_addr,
@@ -260,7 +345,7 @@ func main() {
 				u1 := rusers[i+1]
 				u0.State = playing
 				u1.State = playing
-				go do_game(u0, u1, lobby, *boardlen, *timeout_msec, db)
+				go do_match(u0, u1, lobby, *boardlen, tc, rs, db, stats_store, openings, *paired)
 			}
 		}
 		if log_freq > 10 {
@@ -281,6 +366,11 @@ func do_chaperone(u *User, l *Lobby) {
 	u.Writeline(j)
 	
 	line,err := u.ReadlineTO(1000*10)
+	for err != nil && u.take_pending(l) {
+		// logged in again at the end of its last game
+		u.Writeline(j)
+		line,err = u.ReadlineTO(1000*10)
+	}
 	if err != nil {
 		u.Logout(l,err)
 		log.Println("chaperone: ReadlineTO failed err =", err)
@@ -306,11 +396,73 @@ func (u *User) Logout(l *Lobby, err error) {
 	u.State = logout
 	l.mu.Lock()
 	delete(l.queue, u.Userid)
+	if u.pending != nil {
+		u.pending.Write(str2json(&Logout{Message: "LOGOUT", Reason: err.Error()}))
+		u.pending.Close()
+		u.pending = nil
+	}
 	l.mu.Unlock()
 	log.Println("Logout: userid =", u.Userid, " err =", err.Error())
 }	
 
-func mk_game(b *game.Board, u0 *User, u1 *User, timeout_msec int) *Game {
+// take_pending switches u to the connection of a login that came in while
+// it was playing, if there is one.
+func (u *User) take_pending(l *Lobby) bool {
+	l.mu.Lock()
+	conn := u.pending
+	if conn != nil {
+		u.Conn = conn
+		u.pending = nil
+	}
+	l.mu.Unlock()
+	if conn == nil {
+		return false
+	}
+	u.Rbuf = NewReaderTO(conn, 8192)
+	u.Remote_addr = conn.RemoteAddr().String()
+	return true
+}
+
+// wait_reconnect waits for u to log in again within the grace period of l
+// and takes over the new connection.
+func (u *User) wait_reconnect(l *Lobby) bool {
+	u.Conn.Close()
+	if l.grace <= 0 {
+		return false
+	}
+	resume := make(chan net.Conn, 1)
+	l.mu.Lock()
+	if u.pending != nil {
+		// logged in again before the lost connection was noticed
+		resume <- u.pending
+		u.pending = nil
+	} else {
+		u.resume = resume
+	}
+	l.mu.Unlock()
+	var conn net.Conn
+	select {
+	case conn = <-resume:
+	case <-time.After(l.grace):
+		l.mu.Lock()
+		u.resume = nil
+		l.mu.Unlock()
+		// a login may have come in before u.resume was cleared
+		select {
+		case conn = <-resume:
+		default:
+			return false
+		}
+	}
+	l.mu.Lock()
+	u.Conn = conn
+	l.mu.Unlock()
+	u.Rbuf = NewReaderTO(conn, 8192)
+	u.Remote_addr = conn.RemoteAddr().String()
+	return true
+}
+
+func mk_game(op Opening, u0 *User, u1 *User, tc TimeControl, rs RatingSystem) *Game {
 	gs := &GameState{
 		s: Playing,
 		m: "",
@@ -321,59 +473,189 @@ func mk_game(b *game.Board, u0 *User, u1 *User, timeout_msec int) *Game {
 		EndTime: 0,
 		Black: u0,
 		White: u1,
+		StartPosition: op.Position,
+		StartMoves: op.Moves,
 		Moves: []Move{},
-		Timeout: timeout_msec,
+		Timeout: msec(tc.Move),
+		Clock: new_clock(tc),
+		RatingSystem: rs,
 		State: gs,
-		Board: b,
+		Board: op.board(),
 	}
 	return g
 }
 
-func do_game(u0 *User, u1 *User, l *Lobby, boardlen int, timeout_msec int, db *Database) {
-	sfen := game.MakeInitialSFEN(boardlen)
-	b := game.NewBoardSFEN(boardlen, sfen)
-	g := mk_game(b,u0,u1,timeout_msec)
-	for {
-		g = send_req_get_resp(u0,g)
+// do_match plays the games of a pairing, saves the statistics of the
+// users and sends them back to the lobby. With openings or paired, u0 and
+// u1 play the same start position twice with colors swapped; paired games
+// are also rated as a pair. Statistics are saved before the results are
+// sent, since a player logged out then may log in again at once.
+func do_match(u0 *User, u1 *User, l *Lobby, boardlen int, tc TimeControl, rs RatingSystem, db *Database, stats StatisticsStore, openings *OpeningSet, paired bool) {
+	op := standard_opening(boardlen)
+	if openings != nil {
+		op = openings.pick()
+	}
+	if openings == nil && !paired {
+		g := play_game(u0, u1, op, tc, rs, l)
+		record_game(g, db)
+		update_statistics(g)
+		rate_games(rs, u0, u1, g)
+		save_statistics(stats, u0, u1)
+		send_results(g, l)
+	} else {
+		var pair *PairResult
+		if paired {
+			pair = &PairResult{
+				Pairid: gen_pair_id(),
+				First: u0.Userid,
+				Second: u1.Userid,
+			}
+		}
+		r0, r1 := u0.Statistics.get_rating(), u1.Statistics.get_rating()
+		g1 := play_game(u0, u1, op, tc, rs, l)
+		g1.Pair = pair.add(g1)
+		record_game(g1, db)
+		update_statistics(g1)
+		// a pair cut short is rated by its first game
+		rate_games(rs, u0, u1, g1)
+		save_statistics(stats, u0, u1)
+		send_results(g1, l)
+		if u0.State != logout && u1.State != logout {
+			g2 := play_game(u1, u0, op, tc, rs, l)
+			g2.Pair = pair.add(g2)
+			record_game(g2, db)
+			update_statistics(g2)
+			if paired {
+				// rate the pair again from the ratings before the match
+				u0.Statistics.set_rating(r0)
+				u1.Statistics.set_rating(r1)
+				rate_games(rs, u0, u1, g1, g2)
+			} else {
+				rate_games(rs, u1, u0, g2)
+			}
+			save_statistics(stats, u0, u1)
+			send_results(g2, l)
+		}
+	}
+	for _, u := range []*User{u0, u1} {
+		if u.State != logout {
+			u.State = login
+		}
+	}
+}
+
+// save_statistics stores the statistics of users, logging failures.
+func save_statistics(stats StatisticsStore, users ...*User) {
+	for _, u := range users {
+		if err := stats.SaveStatistics(u.Userid, u.Statistics); err != nil {
+			log.Println("save_statistics: SaveStatistics failed userid =", u.Userid, err)
+		}
+	}
+}
+
+// play_game plays a game between black u0 and white u1 from op.
+func play_game(u0 *User, u1 *User, op Opening, tc TimeControl, rs RatingSystem, l *Lobby) *Game {
+	g := mk_game(op,u0,u1,tc,rs)
+	if g.Board.Turn == game.White {
+		// the opening leaves white to move
+		g = send_req_get_resp(u1,g,l)
+	}
+	for !g.is_gameover() {
+		g = send_req_get_resp(u0,g,l)
 		if g.is_gameover() {
 			break
 		}
-		g = send_req_get_resp(u1,g)
+		g = send_req_get_resp(u1,g,l)
 		if g.is_gameover() {
 			break
 		}
 	}
+	return g
+}
 
+// record_game queues g to be stored in the database.
+func record_game(g *Game, db *Database) {
 	if db != nil {
 		gm := g2gm(g)
 		db.mu.Lock()
 		db.queue = append(db.queue, &gm)
 		db.mu.Unlock()
 	}
+}
+
+// update_statistics counts g in the statistics of its players. Forfeits
+// count as losses.
+func update_statistics(g *Game) {
+	b, w := g.Black.Statistics, g.White.Statistics
+	switch winner(g) {
+	case game.Black:
+		b.n_win++
+		w.n_loss++
+	case game.White:
+		b.n_loss++
+		w.n_win++
+	default:
+		if g.State.s == Draw || g.State.s == DrawAgreed {
+			b.n_draw++
+			w.n_draw++
+		}
+	}
+	switch g.State.s {
+	case BlackIllegalMove:
+		b.n_illegalmove++
+	case WhiteIllegalMove:
+		w.n_illegalmove++
+	case BlackTimeout:
+		b.n_timeout++
+	case WhiteTimeout:
+		w.n_timeout++
+	}
+}
+
+// rated_score returns the points of u in g and whether g counts for the
+// ratings. Illegal moves, timeouts, disconnects and resignations are rated
+// losses.
+func rated_score(g *Game, u *User) (float64, bool) {
+	w := winner(g)
+	if w == game.Black && g.Black == u || w == game.White && g.White == u {
+		return 1.0, true
+	} else if w != -1 {
+		return 0.0, true
+	} else if g.State.s == Draw || g.State.s == DrawAgreed {
+		return 0.5, true
+	}
+	return 0.0, false
+}
 
-	// update statistics and ratings
-	if g.State.s == BlackWin {
-		K := 32.0
-		W := 1.0 / (math.Pow(10.0, (u0.Statistics.rating - u1.Statistics.rating)/400.0) + 1.0)
-		//W := u1.Statistics.rating-u0.Statistics.rating) / 800.0 + 0.5
-		u0.Statistics.rating += K * W
-		u1.Statistics.rating -= K * W
-		u0.Statistics.n_win++
-		u1.Statistics.n_loss++
-	} else if g.State.s == WhiteWin {
-		K := 32.0
-		W := 1.0 / (math.Pow(10.0, (u1.Statistics.rating - u0.Statistics.rating)/400.0) + 1.0)
-		//W := u0.Statistics.rating-u1.Statistics.rating) / 800.0 + 0.5
-		u0.Statistics.rating -= K * W
-		u1.Statistics.rating += K * W
-		u0.Statistics.n_loss++
-		u1.Statistics.n_win++
+// rate_games updates the ratings of u0 and u1 for their games against each
+// other, all rated from the ratings before the first one.
+func rate_games(rs RatingSystem, u0 *User, u1 *User, games ...*Game) {
+	r0 := u0.Statistics.get_rating()
+	r1 := u1.Statistics.get_rating()
+	var res0, res1 []RatedResult
+	for _, g := range games {
+		if s, ok := rated_score(g, u0); ok {
+			res0 = append(res0, RatedResult{Opponent: r1, Score: s})
+			res1 = append(res1, RatedResult{Opponent: r0, Score: 1.0 - s})
+		}
 	}
+	u0.Statistics.set_rating(rs.Update(r0, res0))
+	u1.Statistics.set_rating(rs.Update(r1, res1))
+}
 
+// send_results sends the RESULT of g to its players. A player who
+// disconnected is removed from the lobby instead.
+func send_results(g *Game, l *Lobby) {
 	var wg sync.WaitGroup
-	wg.Add(2)
-	go send_result(u0,g,l,&wg)
-	go send_result(u1,g,l,&wg)
+	for _, u := range []*User{g.Black, g.White} {
+		if g.State.s == BlackDisconnected && u == g.Black || g.State.s == WhiteDisconnected && u == g.White {
+			u.Logout(l, errors.New("disconnected"))
+			u.Conn.Close()
+			continue
+		}
+		wg.Add(1)
+		go send_result(u,g,l,&wg)
+	}
 	wg.Wait()
 }
 
@@ -386,6 +668,11 @@ func send_result(u *User, g *Game, l *Lobby, wg *sync.WaitGroup) {
 	n_wrong_msg := 0
 	for {
 		line,err := u.ReadlineTO(g.Timeout)
+		if err != nil && u.take_pending(l) {
+			// logged in again as the game ended
+			u.Writeline(j)
+			continue
+		}
 		if err != nil {
 			u.Logout(l, err)
 			log.Println("send_result: ReadlineTO failed:", string(line), err)
@@ -412,16 +699,59 @@ func send_result(u *User, g *Game, l *Lobby, wg *sync.WaitGroup) {
 			}
 		}
 	}
-	u.State = login
 }
 
-func send_req_get_resp(u *User, g *Game) *Game {
-	j := game2play(g)
-	u.Writeline(j)
-
+func send_req_get_resp(u *User, g *Game, l *Lobby) *Game {
 	b := g.Board
-	j,err := u.ReadlineTO(g.Timeout)
-	if err != nil {
+	limit := g.Clock.limit(b.Turn)
+	used := time.Duration(0)
+	j := game2play(g, false)
+	offered := false
+	timeout := false
+	var m UserMessage
+	for {
+		line,err := get_reply(u, g, l, j, limit, &used)
+		if g.is_gameover() {
+			// disconnected
+			return g
+		}
+		if err != nil {
+			timeout = true
+			break
+		}
+		m = json2msg(line)
+		switch strings.ToUpper(m.Message) {
+		case "RESIGN":
+			if b.IsBlackTurn() {
+				g.State.s = BlackResigned
+			} else {
+				g.State.s = WhiteResigned
+			}
+			return g
+		case "OFFERDRAW":
+			// one offer a move, the wait for the answer on the clock of u
+			if !offered {
+				start := time.Now()
+				agreed := ask_draw(opponent(g, u), g, limit - used)
+				used += time.Since(start)
+				if agreed {
+					g.State.s = DrawAgreed
+					return g
+				}
+			}
+			// the move is still due, without another PLAY
+			offered = true
+			j = str2json(DrawMessage{Message: "DECLINEDRAW", Gameid: g.Gameid})
+			continue
+		case "ACCEPTDRAW", "DECLINEDRAW":
+			// a late answer to an offer of the opponent, which ask_draw
+			// stopped waiting for
+			j = nil
+			continue
+		}
+		break
+	}
+	if timeout || !g.Clock.spend(b.Turn, used) {
 		if b.IsBlackTurn() {
 			g.State.s = BlackTimeout
 		} else {
@@ -429,7 +759,6 @@ func send_req_get_resp(u *User, g *Game) *Game {
 		}
 		return g
 	}
-	m := json2msg(j)
 	pos,mv,err := g.str2move(m.Message)
 	if err != nil {
 		//log.Println("send_req_get_resp: str2move failure pos =", pos,
@@ -474,11 +803,78 @@ func send_req_get_resp(u *User, g *Game) *Game {
 	return g
 }
 
+// get_reply sends msg, if any, to u, the player to move, and reads its
+// reply within the time left for the move, adding the time taken to used.
+// When the connection is gone the clock stops until u logs in again, then
+// the move starts over; if u does not come back, g ends as a disconnect.
+// Only the connection of the player to move is read, so a player who drops
+// while the opponent thinks is noticed on its next turn, up to a move time
+// plus the grace period later, and the opponent gets its RESULT only then.
+func get_reply(u *User, g *Game, l *Lobby, msg []byte, limit time.Duration, used *time.Duration) ([]byte, error) {
+	for {
+		start := time.Now()
+		var err error
+		if len(msg) > 0 {
+			_,err = u.Writeline(msg)
+		}
+		var line []byte
+		if err == nil {
+			line,err = u.ReadlineTO(msec(limit - *used))
+		}
+		*used += time.Since(start)
+		if err == nil || os.IsTimeout(err) {
+			return line, err
+		}
+		// EOF or reset
+		log.Println("send_req_get_resp: userid =", u.Userid, " disconnected err =", err)
+		if *used >= limit || !u.wait_reconnect(l) {
+			if g.Board.IsBlackTurn() {
+				g.State.s = BlackDisconnected
+			} else {
+				g.State.s = WhiteDisconnected
+			}
+			return nil, err
+		}
+		log.Println("send_req_get_resp: userid =", u.Userid, " resumes game", g.Gameid)
+		msg = game2play(g, true)
+	}
+}
+
+func opponent(g *Game, u *User) *User {
+	if g.Black == u {
+		return g.White
+	}
+	return g.Black
+}
+
+// ask_draw offers a draw to v, who is not to move, and waits up to the
+// per-move timeout, and no longer than wait, for ACCEPTDRAW. Any other
+// answer declines.
+func ask_draw(v *User, g *Game, wait time.Duration) bool {
+	if timeout := time.Duration(g.Timeout) * time.Millisecond; wait > timeout {
+		wait = timeout
+	}
+	if wait <= 0 {
+		return false
+	}
+	_,err := v.Writeline(str2json(DrawMessage{Message: "OFFERDRAW", Gameid: g.Gameid}))
+	if err != nil {
+		return false
+	}
+	line,err := v.ReadlineTO(msec(wait))
+	if err != nil {
+		return false
+	}
+	return strings.ToUpper(json2msg(line).Message) == "ACCEPTDRAW"
+}
+
 func (g *Game) is_gameover() bool {
 	return g.State.s != Playing
 }
 
-func do_login_add_to_lobby(conn net.Conn, lb *Lobby) (*User, error) {
+// do_login_add_to_lobby reads a LOGIN message, or with registration open a
+// REGISTER message that creates the account, and checks the password.
+func do_login_add_to_lobby(conn net.Conn, lb *Lobby, store UserStore, stats StatisticsStore, registration bool) (*User, error) {
 	u := create_user("", conn)
 	line,err := u.ReadlineTO(10000)
 	if err != nil {
@@ -496,21 +892,56 @@ func do_login_add_to_lobby(conn net.Conn, lb *Lobby) (*User, error) {
 		return u, errors.New("broken login message")
 	}
 	// sanity check
-	if l.Message != "LOGIN" || len(l.Userid) == 0 || len(l.Password) == 0 {
+	if l.Message != "LOGIN" && !(l.Message == "REGISTER" && registration) ||
+		len(l.Userid) == 0 || len(l.Password) == 0 {
 		log.Println("do_login: Login failed 2 ", line, err)
 		return u, errors.New("failed login attempt")
 	}
 
 	u.Userid = l.Userid
+	if l.Message == "REGISTER" {
+		err = store.Register(l.Userid, l.Password)
+		if err == nil {
+			log.Println("do_login: registered userid =", u.Userid)
+		}
+	} else {
+		err = store.Authenticate(l.Userid, l.Password)
+	}
+	if err != nil {
+		return u, err
+	}
+	u.Statistics, err = stats.LoadStatistics(l.Userid)
+	if err != nil {
+		log.Println("do_login: LoadStatistics failed userid =", u.Userid, err)
+		return u, errors.New("statistics not available")
+	}
 	u.State = login
 	lb.mu.Lock()
-	if _, ok := lb.queue[u.Userid]; ok {
+	if old, ok := lb.queue[u.Userid]; ok && old.resume != nil {
+		// back in time to resume its game
+		old.resume <- conn
+		old.resume = nil
+		lb.mu.Unlock()
+		log.Println("do_login: userid =", u.Userid, " reconnected")
+		return u, nil
+	} else if ok && old.State == playing && lb.grace > 0 {
+		// the game has not noticed the lost connection yet: closing it
+		// fails the next read or write, and wait_reconnect, send_result or
+		// do_chaperone takes conn
+		if old.pending != nil {
+			old.pending.Close()
+		}
+		old.pending = conn
+		old.Conn.Close()
+		lb.mu.Unlock()
+		log.Println("do_login: userid =", u.Userid, " reconnected while playing")
+		return u, nil
+	} else if ok {
 		lb.mu.Unlock()
 		u.State = logout
 		log.Println("do_login: userid =", u.Userid, " already exists")
-		return u, errors.New("duplicate login")
+		return u, err_duplicate_login
 	} else {
-		// TODO password check
 		lb.queue[u.Userid] = u
 		lb.mu.Unlock()
 		return u, nil
@@ -526,15 +957,20 @@ func send_logout(u *User, err error) {
 	u.Writeline(j)
 }
 
-func game2play(g *Game) []byte {
+// game2play makes a PLAY message with the last move, or with all the
+// moves for a user resuming the game.
+func game2play(g *Game, resume bool) []byte {
 	b := g.Board
 	turn := []string{"black", "white"}[b.Turn]
 	moves := []Move{}
-	if len(g.Moves) != 0 {
+	if resume {
+		moves = g.Moves
+	} else if len(g.Moves) != 0 {
 		moves = []Move{g.Moves[len(g.Moves)-1]}
 	}
 	m := GameMessage{
 		Message: "PLAY",
+		Resume: resume,
 		Gameid: g.Gameid,
 		StartTime: g.StartTime,
 		EndTime: g.EndTime,
@@ -544,14 +980,22 @@ func game2play(g *Game) []byte {
 		WhiteRating: strconv.Itoa(int(g.White.Statistics.rating)),
 		Turn: turn,
 		Position: b.ToSFEN(),
+		StartPosition: g.StartPosition,
+		StartMoves: g.StartMoves,
 		Moves: moves,
 		BoardSize: b.Boardlen,
-		Timeout: g.Timeout,
+		Timeout: msec(g.Clock.limit(b.Turn)),
 		State: gamestate2str(g),
 	}
+	g.Clock.fill_clock(&m)
+	g.fill_ratings(&m)
 	return str2json(m)
 }
 
+// positions in RESULT messages and stored games are written with rows and
+// a move counter so that they are readable and tell the board size
+var record_sfen = game.SFENOptions{Rows: true, MoveCounter: true}
+
 func game2result(g *Game) []byte {
 	b := g.Board
 	turn := []string{"black", "white"}[b.Turn]
@@ -565,12 +1009,19 @@ func game2result(g *Game) []byte {
 		White: g.White.Userid,
 		WhiteRating: strconv.Itoa(int(g.White.Statistics.rating)),
 		Turn: turn,
-		Position: b.ToSFEN(),
+		Position: b.FormatSFEN(record_sfen),
+		StartPosition: g.StartPosition,
+		StartMoves: g.StartMoves,
 		Moves: g.Moves,
 		BoardSize: b.Boardlen,
 		Timeout: g.Timeout,
 		State: gamestate2str(g),
+		Pair: g.Pair,
+		BlackStatistics: g.Black.Statistics.result_statistics(),
+		WhiteStatistics: g.White.Statistics.result_statistics(),
 	}
+	g.Clock.fill_clock(&m)
+	g.fill_ratings(&m)
 	return str2json(m)
 }
 
@@ -587,12 +1038,17 @@ func g2gm(g *Game) *GameMessage {
 		White: g.White.Userid,
 		WhiteRating: strconv.Itoa(int(g.White.Statistics.rating)),
 		Turn: turn,
-		Position: b.ToSFEN(),
+		Position: b.FormatSFEN(record_sfen),
+		StartPosition: g.StartPosition,
+		StartMoves: g.StartMoves,
 		Moves: g.Moves,
 		BoardSize: b.Boardlen,
 		Timeout: g.Timeout,
 		State: gamestate2str(g),
+		Pair: g.Pair,
 	}
+	g.Clock.fill_clock(&m)
+	g.fill_ratings(&m)
 	return &m
 }
 
@@ -677,13 +1133,13 @@ func (g *Game) str2move(msg string) (int,Move,error) {
 
 // 4 messages from users
 type Login struct {
-	Message  string // LOGIN
+	Message  string // LOGIN, REGISTER
 	Userid   string
 	Password string
 }
 
 type UserMessage struct {
-	Message string // READY, a6,A6, pass,PASS, LOGOUT
+	Message string // READY, a6,A6, pass,PASS, LOGOUT, RESIGN, OFFERDRAW, ACCEPTDRAW, DECLINEDRAW
 }
 
 // messagers from server
@@ -696,6 +1152,14 @@ type IsReady struct {
 	Message string
 }
 
+// DrawMessage passes a draw offer to the opponent, or tells the player who
+// offered that it was declined. After a DECLINEDRAW the player who offered
+// still sends its move, without another PLAY.
+type DrawMessage struct {
+	Message string // OFFERDRAW, DECLINEDRAW
+	Gameid  string
+}
+
 type GameStateCode int
 
 const (
@@ -709,6 +1173,9 @@ const (
 	BlackDisconnected
 	WhiteDisconnected
 	Draw
+	BlackResigned
+	WhiteResigned
+	DrawAgreed
 )
 
 type GameState struct {
@@ -728,6 +1195,9 @@ func gamestate2str(g *Game) string {
 		"black disconnected",
 		"white disconnected",
 		"draw",
+		"black resigned",
+		"white resigned",
+		"draw agreed",
 	}
 	if g.State.s == BlackWin || g.State.s == WhiteWin || g.State.s == Draw {
 		return msg_list[int(g.State.s)] + " " + g.State.m
@@ -744,9 +1214,14 @@ type Game struct {
 	EndTime    int64
 	Black      *User
 	White      *User
+	StartPosition string // SFEN the game started from
+	StartMoves []Move // opening moves played from StartPosition
 	Moves      []Move
-	Timeout    int
+	Timeout    int // msec, per move and for RESULTOK
+	Clock      *Clock
+	RatingSystem RatingSystem
 	State      *GameState
+	Pair       *PairResult // nil unless the game is one of a pair
 	Board      *game.Board //pointer to Board
 }
 
@@ -759,12 +1234,98 @@ type GameMessage struct {
 	BlackRating string
 	White       string
 	WhiteRating string
+	RatingSystem string
+	BlackRD     string `json:",omitempty"`
+	BlackVolatility string `json:",omitempty"`
+	WhiteRD     string `json:",omitempty"`
+	WhiteVolatility string `json:",omitempty"`
 	Turn        string
 	Position    string
-	Moves       []Move
+	StartPosition string
+	StartMoves  []Move
+	Moves       []Move // in PLAY messages the last move, or all with Resume
+	Resume      bool `json:",omitempty"`
 	BoardSize   int
-	Timeout     int
+	Timeout     int // msec, for this move in PLAY messages
+	Clock       string
+	BlackTime   int `json:",omitempty"` // msec left in the time banks
+	WhiteTime   int `json:",omitempty"`
+	Increment   int `json:",omitempty"`
+	Byoyomi     int `json:",omitempty"`
 	State       string
+	Pair        *PairResult `json:",omitempty"`
+	BlackStatistics *ResultStatistics `json:",omitempty"` // in RESULT messages
+	WhiteStatistics *ResultStatistics `json:",omitempty"`
+}
+
+// ResultStatistics are the game counts of a user after a game.
+type ResultStatistics struct {
+	Wins         int
+	Losses       int // including forfeits
+	Draws        int
+	IllegalMoves int
+	Timeouts     int
+}
+
+func (st *UserStatistics) result_statistics() *ResultStatistics {
+	return &ResultStatistics{
+		Wins: st.n_win,
+		Losses: st.n_loss,
+		Draws: st.n_draw,
+		IllegalMoves: st.n_illegalmove,
+		Timeouts: st.n_timeout,
+	}
+}
+
+// PairResult is the score of a pair of games with colors swapped, after
+// game number Game of the two. First played black in the first game.
+type PairResult struct {
+	Pairid      string
+	Game        int
+	First       string
+	Second      string
+	FirstScore  float64
+	SecondScore float64
+}
+
+// winner returns the color that won g, or -1 for a draw or a game in
+// progress.
+func winner(g *Game) int {
+	switch g.State.s {
+	case BlackWin, WhiteIllegalMove, WhiteTimeout, WhiteDisconnected, WhiteResigned:
+		return game.Black
+	case WhiteWin, BlackIllegalMove, BlackTimeout, BlackDisconnected, BlackResigned:
+		return game.White
+	}
+	return -1
+}
+
+// add returns the pair result after g, the next game of the pair. A nil
+// pair stays nil.
+func (p *PairResult) add(g *Game) *PairResult {
+	if p == nil {
+		return nil
+	}
+	p.Game++
+	first_color := game.Black
+	if g.Black.Userid != p.First {
+		first_color = game.White
+	}
+	switch winner(g) {
+	case first_color:
+		p.FirstScore += 1
+	case 1 - first_color:
+		p.SecondScore += 1
+	default:
+		p.FirstScore += 0.5
+		p.SecondScore += 0.5
+	}
+	r := *p
+	return &r
+}
+
+func gen_pair_id() string {
+	return "pair" + strings.TrimPrefix(gen_game_id(), "game")
 }
 
 func gen_game_id() string {
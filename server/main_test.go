@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"game"
+)
+
+// counts returns the game counts of st as win, loss, draw, illegal move
+// and timeout.
+func counts(st *UserStatistics) [5]int {
+	return [5]int{st.n_win, st.n_loss, st.n_draw, st.n_illegalmove, st.n_timeout}
+}
+
+func TestGameStates(t *testing.T) {
+	tests := []struct {
+		s GameStateCode
+		winner int
+		score float64 // of black
+		rated bool
+		black, white [5]int
+	}{
+		{Playing, -1, 0, false, [5]int{}, [5]int{}},
+		{BlackWin, game.Black, 1, true, [5]int{1, 0, 0, 0, 0}, [5]int{0, 1, 0, 0, 0}},
+		{WhiteWin, game.White, 0, true, [5]int{0, 1, 0, 0, 0}, [5]int{1, 0, 0, 0, 0}},
+		{BlackIllegalMove, game.White, 0, true, [5]int{0, 1, 0, 1, 0}, [5]int{1, 0, 0, 0, 0}},
+		{WhiteIllegalMove, game.Black, 1, true, [5]int{1, 0, 0, 0, 0}, [5]int{0, 1, 0, 1, 0}},
+		{BlackTimeout, game.White, 0, true, [5]int{0, 1, 0, 0, 1}, [5]int{1, 0, 0, 0, 0}},
+		{WhiteTimeout, game.Black, 1, true, [5]int{1, 0, 0, 0, 0}, [5]int{0, 1, 0, 0, 1}},
+		{BlackDisconnected, game.White, 0, true, [5]int{0, 1, 0, 0, 0}, [5]int{1, 0, 0, 0, 0}},
+		{WhiteDisconnected, game.Black, 1, true, [5]int{1, 0, 0, 0, 0}, [5]int{0, 1, 0, 0, 0}},
+		{Draw, -1, 0.5, true, [5]int{0, 0, 1, 0, 0}, [5]int{0, 0, 1, 0, 0}},
+		{BlackResigned, game.White, 0, true, [5]int{0, 1, 0, 0, 0}, [5]int{1, 0, 0, 0, 0}},
+		{WhiteResigned, game.Black, 1, true, [5]int{1, 0, 0, 0, 0}, [5]int{0, 1, 0, 0, 0}},
+		{DrawAgreed, -1, 0.5, true, [5]int{0, 0, 1, 0, 0}, [5]int{0, 0, 1, 0, 0}},
+	}
+	for i, tt := range tests {
+		if tt.s != GameStateCode(i) {
+			t.Fatalf("state %d listed as %d", i, tt.s)
+		}
+		g := &Game{
+			Black: &User{Userid: "b", Statistics: new_statistics()},
+			White: &User{Userid: "w", Statistics: new_statistics()},
+			State: &GameState{s: tt.s, m: "32-32"},
+		}
+		// panics for a code without a name
+		str := gamestate2str(g)
+		if str == "" || strings.HasPrefix(str, " ") {
+			t.Errorf("state %d: %q", tt.s, str)
+		}
+		if w := winner(g); w != tt.winner {
+			t.Errorf("%s: winner %d, want %d", str, w, tt.winner)
+		}
+		bs, bok := rated_score(g, g.Black)
+		ws, wok := rated_score(g, g.White)
+		if bs != tt.score || bok != tt.rated || wok != tt.rated || tt.rated && bs + ws != 1 {
+			t.Errorf("%s: scores %v %v, %v %v", str, bs, bok, ws, wok)
+		}
+		update_statistics(g)
+		if b, w := counts(g.Black.Statistics), counts(g.White.Statistics); b != tt.black || w != tt.white {
+			t.Errorf("%s: counts %v %v, want %v %v", str, b, w, tt.black, tt.white)
+		}
+	}
+}
+
+func TestPairResult(t *testing.T) {
+	u0 := &User{Userid: "u0", Statistics: new_statistics()}
+	u1 := &User{Userid: "u1", Statistics: new_statistics()}
+	game_of := func(black, white *User, s GameStateCode) *Game {
+		return &Game{Black: black, White: white, State: &GameState{s: s}}
+	}
+	tests := []struct {
+		s1, s2 GameStateCode // u0 black in the first game, u1 in the second
+		first1, second1, first2, second2 float64
+	}{
+		{BlackWin, BlackWin, 1, 0, 1, 1},
+		{WhiteWin, WhiteWin, 0, 1, 1, 1},
+		{BlackWin, WhiteWin, 1, 0, 2, 0},
+		{Draw, DrawAgreed, 0.5, 0.5, 1, 1},
+		{WhiteTimeout, BlackResigned, 1, 0, 2, 0},
+		{BlackDisconnected, WhiteIllegalMove, 0, 1, 0, 2},
+	}
+	for _, tt := range tests {
+		p := &PairResult{Pairid: "pair", First: u0.Userid, Second: u1.Userid}
+		r1 := p.add(game_of(u0, u1, tt.s1))
+		r2 := p.add(game_of(u1, u0, tt.s2))
+		if r1.Game != 1 || r1.FirstScore != tt.first1 || r1.SecondScore != tt.second1 ||
+			r2.Game != 2 || r2.FirstScore != tt.first2 || r2.SecondScore != tt.second2 {
+			t.Errorf("%d, %d: %+v then %+v", tt.s1, tt.s2, r1, r2)
+		}
+	}
+	var p *PairResult
+	if r := p.add(game_of(u0, u1, BlackWin)); r != nil {
+		t.Errorf("game without a pair: %+v", r)
+	}
+}
+
+func TestRateGames(t *testing.T) {
+	tests := []struct {
+		s1, s2 GameStateCode // u0 black in the first game, u1 in the second
+		r0, r1 float64
+	}{
+		// both games from the ratings before the first
+		{BlackWin, BlackWin, 1500, 1500},
+		{BlackWin, Draw, 1516, 1484},
+		{WhiteWin, BlackWin, 1500 - 32, 1500 + 32},
+		{BlackWin, Playing, 1516, 1484},
+	}
+	for _, tt := range tests {
+		u0 := &User{Userid: "u0", Statistics: new_statistics()}
+		u1 := &User{Userid: "u1", Statistics: new_statistics()}
+		g1 := &Game{Black: u0, White: u1, State: &GameState{s: tt.s1}}
+		g2 := &Game{Black: u1, White: u0, State: &GameState{s: tt.s2}}
+		rate_games(Elo{K: 32}, u0, u1, g1, g2)
+		if r0, r1 := u0.Statistics.rating, u1.Statistics.rating; r0 != tt.r0 || r1 != tt.r1 {
+			t.Errorf("%d, %d: ratings %v %v, want %v %v", tt.s1, tt.s2, r0, r1, tt.r0, tt.r1)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"regexp"
+	"strings"
+
+	"book"
+	"game"
+)
+
+// Opening is the start of a game: a position, and moves played from it
+// before the players take over.
+type Opening struct {
+	Position string // SFEN, written with record_sfen
+	Moves []Move
+}
+
+// OpeningSet gives the openings of the games. Openings come from a file,
+// or are random balanced lines of an opening book.
+type OpeningSet struct {
+	boardlen int
+	openings []Opening
+	book *book.Book
+	book_plies int
+}
+
+// standard_opening is the initial position with no moves.
+func standard_opening(boardlen int) Opening {
+	b := game.NewBoardSFEN(boardlen, game.MakeInitialSFEN(boardlen))
+	return Opening{Position: b.FormatSFEN(record_sfen)}
+}
+
+var opening_move_re = regexp.MustCompile(`(?i)pass|[a-z]{1,2}[0-9]+`)
+
+// looks_like_sfen tells a broken SFEN from moves by its row separators or
+// side to move field.
+func looks_like_sfen(line string) bool {
+	fields := strings.Fields(line)
+	return strings.Contains(line, "/") ||
+		len(fields) >= 2 && (fields[1] == "b" || fields[1] == "w")
+}
+
+// parse_opening reads a line of an openings file: an SFEN, or moves from
+// the initial position such as "f5 d6 c3" or "f5d6c3".
+func parse_opening(line string, boardlen int) (Opening, error) {
+	if b, err := game.ParseSFEN(boardlen, line); err == nil {
+		if b.IsGameOver() {
+			return Opening{}, errors.New("game over position")
+		}
+		return Opening{Position: b.FormatSFEN(record_sfen)}, nil
+	} else if looks_like_sfen(line) {
+		return Opening{}, err
+	}
+	strs := opening_move_re.FindAllString(line, -1)
+	if strings.Join(strs, "") != strings.Join(strings.Fields(line), "") {
+		return Opening{}, errors.New("neither an SFEN nor moves")
+	}
+	op := standard_opening(boardlen)
+	b := game.NewBoardSFEN(boardlen, game.MakeInitialSFEN(boardlen))
+	for _, s := range strs {
+		mv, err := b.Str2Position(s)
+		if err != nil {
+			return Opening{}, err
+		}
+		if !b.IsLegalMove(mv) {
+			return Opening{}, fmt.Errorf("illegal move %s", s)
+		}
+		b.MoveUpdate(mv)
+		op.Moves = append(op.Moves, Move(strings.ToLower(s)))
+	}
+	if b.IsGameOver() {
+		return Opening{}, errors.New("game over position")
+	}
+	return op, nil
+}
+
+// load_openings reads an openings file, one opening per line. Empty lines
+// and lines starting with # are skipped.
+func load_openings(name string, boardlen int) (*OpeningSet, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	set := &OpeningSet{boardlen: boardlen}
+	sc := bufio.NewScanner(f)
+	for ln := 1; sc.Scan(); ln++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		op, err := parse_opening(line, boardlen)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, ln, err)
+		}
+		set.openings = append(set.openings, op)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(set.openings) == 0 {
+		return nil, fmt.Errorf("%s: no openings", name)
+	}
+	return set, nil
+}
+
+// load_book_openings makes openings of up to plies balanced book moves.
+func load_book_openings(name string, boardlen int, plies int) (*OpeningSet, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	bk, err := book.ReadBook(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return &OpeningSet{boardlen: boardlen, book: bk, book_plies: plies}, nil
+}
+
+const (
+	book_opening_games = 2 // book moves played in fewer games are not used
+	book_opening_balance = 0.15 // nor those scoring further from one half
+)
+
+// pick returns a random opening.
+func (set *OpeningSet) pick() Opening {
+	if set.book == nil {
+		return set.openings[rand.Intn(len(set.openings))]
+	}
+	b := game.NewBoardSFEN(set.boardlen, game.MakeInitialSFEN(set.boardlen))
+	rng := rand.New(rand.NewSource(rand.Int63()))
+	op := standard_opening(set.boardlen)
+	for _, mv := range set.book.RandomOpening(b, set.book_plies, book_opening_games, book_opening_balance, rng) {
+		s := "pass"
+		if mv != -1 {
+			s = b.Position2Str(mv)
+		}
+		op.Moves = append(op.Moves, Move(s))
+		b.MoveUpdate(mv)
+	}
+	return op
+}
+
+// board returns the position after the opening.
+func (op *Opening) board() *game.Board {
+	b, err := game.ParseSFEN(0, op.Position)
+	if err != nil {
+		panic(err) // openings are checked when they are loaded
+	}
+	for _, s := range op.Moves {
+		mv, _ := b.Str2Position(string(s))
+		b.MoveUpdate(mv)
+	}
+	return b
+}
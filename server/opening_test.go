@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"book"
+	"game"
+)
+
+func TestParseOpening(t *testing.T) {
+	initial := standard_opening(8).Position
+	tests := []struct {
+		line string
+		boardlen int
+		op Opening
+		err string // start of the error, "" for none
+	}{
+		{"27wb6bw27 b", 8, Opening{Position: initial}, ""},
+		{"8/8/8/3wb3/3bw3/8/8/8 b 1", 8, Opening{Position: initial}, ""},
+		{"f5 d6 c3", 8, Opening{Position: initial, Moves: []Move{"f5", "d6", "c3"}}, ""},
+		{"F5D6C3", 8, Opening{Position: initial, Moves: []Move{"f5", "d6", "c3"}}, ""},
+		{"a2 a1 c4 d4 d3 d2 c1 b4 a3 b1 pass d1 pass", 4,
+			Opening{Position: standard_opening(4).Position,
+				Moves: []Move{"a2", "a1", "c4", "d4", "d3", "d2", "c1", "b4", "a3", "b1", "pass", "d1", "pass"}}, ""},
+		{"b63 w", 8, Opening{}, "game over position"},
+		{"a2 a1 c4 d4 d3 d2 c1 b4 a3 b1 pass d1 pass a4", 4, Opening{}, "game over position"},
+		{"f5 f5", 8, Opening{}, "illegal move f5"},
+		{"pass", 8, Opening{}, "illegal move pass"},
+		{"27wb6bw27x b", 8, Opening{}, "sfen"},
+		{"8/8 b", 8, Opening{}, "sfen"},
+		{"hello world", 8, Opening{}, "neither an SFEN nor moves"},
+	}
+	for _, tt := range tests {
+		op, err := parse_opening(tt.line, tt.boardlen)
+		if tt.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), tt.err) {
+				t.Errorf("%q: error %v, want %q", tt.line, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(op, tt.op) {
+			t.Errorf("%q: %+v, %v; want %+v", tt.line, op, err, tt.op)
+		}
+	}
+}
+
+func TestOpeningBoard(t *testing.T) {
+	op, err := parse_opening("f5 d6 c3", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := op.board()
+	want := game.NewBoardSFEN(8, game.MakeInitialSFEN(8))
+	for _, s := range []string{"f5", "d6", "c3"} {
+		mv, _ := want.Str2Position(s)
+		want.MoveUpdate(mv)
+	}
+	if b.ToSFEN() != want.ToSFEN() || b.Turn != game.White {
+		t.Errorf("board %s, want %s", b.ToSFEN(), want.ToSFEN())
+	}
+}
+
+func TestPickBook(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	bk := book.NewBook(6)
+	start := game.NewBoardSFEN(6, game.MakeInitialSFEN(6))
+	for i := 0; i < 200; i++ {
+		b := start.Copy()
+		var moves []game.Position
+		for !b.IsGameOver() {
+			mv := game.Position(-1)
+			if lms := b.LegalMoves(); len(lms) != 0 {
+				mv = lms[rng.Intn(len(lms))]
+			}
+			moves = append(moves, mv)
+			b.MoveUpdate(mv)
+		}
+		if err := bk.AddGame(start, moves); err != nil {
+			t.Fatal(err)
+		}
+	}
+	set := &OpeningSet{boardlen: 6, book: bk, book_plies: 4}
+	n_moves := 0
+	for i := 0; i < 20; i++ {
+		op := set.pick()
+		if op.Position != standard_opening(6).Position || len(op.Moves) > 4 {
+			t.Fatalf("opening %+v", op)
+		}
+		b := start.Copy()
+		for _, s := range op.Moves {
+			mv, err := b.Str2Position(string(s))
+			if err != nil || !b.IsLegalMove(mv) {
+				t.Fatalf("illegal move %s in %v", s, op.Moves)
+			}
+			b.MoveUpdate(mv)
+		}
+		n_moves += len(op.Moves)
+	}
+	if n_moves == 0 {
+		t.Error("no book moves in 20 openings")
+	}
+}
+
+func TestPickOpenings(t *testing.T) {
+	ops := []Opening{standard_opening(8), {Position: standard_opening(8).Position, Moves: []Move{"f5"}}}
+	set := &OpeningSet{boardlen: 8, openings: ops}
+	for i := 0; i < 10; i++ {
+		if op := set.pick(); !reflect.DeepEqual(op, ops[0]) && !reflect.DeepEqual(op, ops[1]) {
+			t.Errorf("picked %+v", op)
+		}
+	}
+}
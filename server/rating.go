@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Rating is the strength of a user and how sure it is. Elo leaves RD and
+// Volatility alone.
+type Rating struct {
+	Rating     float64
+	RD         float64 // rating deviation
+	Volatility float64
+}
+
+var initial_rating = Rating{Rating: 1500.0, RD: 350.0, Volatility: 0.06}
+
+// RatedResult is a rated game against Opponent: Score is 1 for a win, 0.5
+// for a draw and 0 for a loss.
+type RatedResult struct {
+	Opponent Rating
+	Score    float64
+}
+
+// RatingSystem updates ratings after the games of a match.
+type RatingSystem interface {
+	Name() string
+	// Update returns r after results, rated together from the ratings
+	// before the first game.
+	Update(r Rating, results []RatedResult) Rating
+}
+
+func new_rating_system(name string) (RatingSystem, error) {
+	switch name {
+	case "elo":
+		return Elo{K: 32.0}, nil
+	case "glicko2":
+		return Glicko2{Tau: 0.5}, nil
+	}
+	return nil, fmt.Errorf("unknown rating system %q", name)
+}
+
+type Elo struct {
+	K float64
+}
+
+func (e Elo) Name() string {
+	return "elo"
+}
+
+func (e Elo) Update(r Rating, results []RatedResult) Rating {
+	delta := 0.0
+	for _, res := range results {
+		// expected score
+		E := 1.0 / (math.Pow(10.0, (res.Opponent.Rating - r.Rating)/400.0) + 1.0)
+		delta += e.K * (res.Score - E)
+	}
+	r.Rating += delta
+	return r
+}
+
+// Glicko2 is Glickman's Glicko-2 system with a match as the rating period.
+// Tau bounds how fast the volatility changes.
+type Glicko2 struct {
+	Tau float64
+}
+
+func (gl Glicko2) Name() string {
+	return "glicko2"
+}
+
+const glicko2_scale = 173.7178
+
+func glicko2_g(phi float64) float64 {
+	return 1.0 / math.Sqrt(1.0 + 3.0*phi*phi/(math.Pi*math.Pi))
+}
+
+func (gl Glicko2) Update(r Rating, results []RatedResult) Rating {
+	if len(results) == 0 {
+		return r
+	}
+	mu := (r.Rating - initial_rating.Rating) / glicko2_scale
+	phi := r.RD / glicko2_scale
+	sigma := r.Volatility
+
+	// estimated variance v and improvement delta
+	v_inv, sum := 0.0, 0.0
+	for _, res := range results {
+		mu_j := (res.Opponent.Rating - initial_rating.Rating) / glicko2_scale
+		g := glicko2_g(res.Opponent.RD / glicko2_scale)
+		E := 1.0 / (1.0 + math.Exp(-g*(mu - mu_j)))
+		v_inv += g*g*E*(1.0 - E)
+		sum += g*(res.Score - E)
+	}
+	v := 1.0 / v_inv
+	delta := v * sum
+
+	// new volatility by the Illinois algorithm
+	tau2 := gl.Tau * gl.Tau
+	a := math.Log(sigma*sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta - phi*phi - v - ex)/(2.0*d*d) - (x - a)/tau2
+	}
+	A := a
+	var B float64
+	if delta*delta > phi*phi + v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a - k*gl.Tau) < 0 {
+			k++
+		}
+		B = a - k*gl.Tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B - A) > 1e-6 {
+		C := A + (A - B)*fA/(fB - fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	sigma = math.Exp(A/2)
+
+	phi_star := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1.0 / math.Sqrt(1.0/(phi_star*phi_star) + 1.0/v)
+	mu += phi*phi*sum
+	return Rating{
+		Rating: mu*glicko2_scale + initial_rating.Rating,
+		RD: phi*glicko2_scale,
+		Volatility: sigma,
+	}
+}
+
+func (st *UserStatistics) get_rating() Rating {
+	return Rating{Rating: st.rating, RD: st.rd, Volatility: st.volatility}
+}
+
+func (st *UserStatistics) set_rating(r Rating) {
+	st.rating, st.rd, st.volatility = r.Rating, r.RD, r.Volatility
+}
+
+// fill_ratings sets the rating deviations and volatilities of a PLAY or
+// RESULT message, which only Glicko-2 has.
+func (g *Game) fill_ratings(m *GameMessage) {
+	m.RatingSystem = g.RatingSystem.Name()
+	if _, ok := g.RatingSystem.(Glicko2); !ok {
+		return
+	}
+	b, w := g.Black.Statistics, g.White.Statistics
+	m.BlackRD = strconv.Itoa(int(b.rd))
+	m.BlackVolatility = strconv.FormatFloat(b.volatility, 'f', 5, 64)
+	m.WhiteRD = strconv.Itoa(int(w.rd))
+	m.WhiteVolatility = strconv.FormatFloat(w.volatility, 'f', 5, 64)
+}
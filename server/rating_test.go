@@ -0,0 +1,36 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestGlicko2(t *testing.T) {
+	// the example of Glickman's description of Glicko-2
+	r := Glicko2{Tau: 0.5}.Update(Rating{1500, 200, 0.06}, []RatedResult{
+		{Rating{1400, 30, 0.06}, 1},
+		{Rating{1550, 100, 0.06}, 0},
+		{Rating{1700, 300, 0.06}, 0},
+	})
+	want := Rating{1464.05, 151.52, 0.05999}
+	if math.Abs(r.Rating - want.Rating) > 0.01 || math.Abs(r.RD - want.RD) > 0.01 ||
+		math.Abs(r.Volatility - want.Volatility) > 0.00001 {
+		t.Errorf("%+v, want %+v", r, want)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	for _, rs := range []RatingSystem{Elo{K: 32}, Glicko2{Tau: 0.5}} {
+		r := rs.Update(initial_rating, []RatedResult{{initial_rating, 0.5}})
+		if math.Abs(r.Rating - initial_rating.Rating) > 1e-9 {
+			t.Errorf("%s: draw between equal ratings gives %v", rs.Name(), r.Rating)
+		}
+		low, high := Rating{1400, 100, 0.06}, Rating{1600, 100, 0.06}
+		if r := rs.Update(low, []RatedResult{{high, 0.5}}); r.Rating <= low.Rating {
+			t.Errorf("%s: draw against a stronger player gives %v", rs.Name(), r.Rating)
+		}
+		if r := rs.Update(high, []RatedResult{{low, 0.5}}); r.Rating >= high.Rating {
+			t.Errorf("%s: draw against a weaker player gives %v", rs.Name(), r.Rating)
+		}
+	}
+}
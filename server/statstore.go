@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// StatisticsStore keeps the statistics of the users across logins and
+// server restarts.
+type StatisticsStore interface {
+	// LoadStatistics returns the statistics of userid, new ones if it
+	// has none.
+	LoadStatistics(userid string) (*UserStatistics, error)
+	SaveStatistics(userid string, st *UserStatistics) error
+}
+
+// statistics_record is a UserStatistics as saved by FileStatisticsStore.
+type statistics_record struct {
+	Rating       float64
+	RD           float64
+	Volatility   float64
+	Wins         int
+	Losses       int
+	Draws        int
+	IllegalMoves int
+	Timeouts     int
+}
+
+// FileStatisticsStore is a StatisticsStore saved as a JSON file, rewritten
+// on every change.
+type FileStatisticsStore struct {
+	name string
+	records map[string]statistics_record
+	mu sync.Mutex
+}
+
+// open_statistics_store loads the statistics of the file name, which need
+// not exist yet.
+func open_statistics_store(name string) (*FileStatisticsStore, error) {
+	s := &FileStatisticsStore{
+		name: name,
+		records: make(map[string]statistics_record),
+	}
+	b, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.records); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStatisticsStore) LoadStatistics(userid string) (*UserStatistics, error) {
+	s.mu.Lock()
+	r, ok := s.records[userid]
+	s.mu.Unlock()
+	if !ok {
+		return new_statistics(), nil
+	}
+	if r.RD == 0 {
+		// saved before ratings had deviations
+		r.RD, r.Volatility = initial_rating.RD, initial_rating.Volatility
+	}
+	return &UserStatistics{
+		rating: r.Rating,
+		rd: r.RD,
+		volatility: r.Volatility,
+		n_win: r.Wins,
+		n_loss: r.Losses,
+		n_draw: r.Draws,
+		n_illegalmove: r.IllegalMoves,
+		n_timeout: r.Timeouts,
+	}, nil
+}
+
+func (s *FileStatisticsStore) SaveStatistics(userid string, st *UserStatistics) error {
+	r := statistics_record{
+		Rating: st.rating,
+		RD: st.rd,
+		Volatility: st.volatility,
+		Wins: st.n_win,
+		Losses: st.n_loss,
+		Draws: st.n_draw,
+		IllegalMoves: st.n_illegalmove,
+		Timeouts: st.n_timeout,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.records[userid]
+	s.records[userid] = r
+	if err := write_json_file(s.name, s.records); err != nil {
+		if ok {
+			s.records[userid] = old
+		} else {
+			delete(s.records, userid)
+		}
+		return err
+	}
+	return nil
+}
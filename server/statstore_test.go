@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStatisticsStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "statistics.json")
+	s, err := open_statistics_store(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := s.LoadStatistics("alice"); err != nil || !reflect.DeepEqual(st, new_statistics()) {
+		t.Errorf("new user: %+v, %v", st, err)
+	}
+	want := &UserStatistics{rating: 1612.5, rd: 80, volatility: 0.059, n_win: 3, n_loss: 2, n_draw: 1, n_illegalmove: 1, n_timeout: 1}
+	if err := s.SaveStatistics("alice", want); err != nil {
+		t.Fatal(err)
+	}
+	s, err = open_statistics_store(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st, err := s.LoadStatistics("alice"); err != nil || !reflect.DeepEqual(st, want) {
+		t.Errorf("after reopening: %+v, %v; want %+v", st, err, want)
+	}
+}
+
+func TestStatisticsWithoutRD(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "statistics.json")
+	// saved before ratings had deviations
+	if err := os.WriteFile(name, []byte(`{"alice": {"Rating": 1600, "Wins": 3}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := open_statistics_store(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st, err := s.LoadStatistics("alice")
+	if err != nil || st.rating != 1600 || st.rd != initial_rating.RD ||
+		st.volatility != initial_rating.Volatility || st.n_win != 3 {
+		t.Errorf("%+v, %v", st, err)
+	}
+}
+
+func TestStatisticsFailedSave(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "stats")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	s, err := open_statistics_store(filepath.Join(dir, "statistics.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := &UserStatistics{rating: 1550, rd: 200, volatility: 0.06, n_win: 1}
+	if err := s.SaveStatistics("alice", old); err != nil {
+		t.Fatal(err)
+	}
+	// no directory to write the file to
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveStatistics("alice", &UserStatistics{rating: 1580, rd: 190, volatility: 0.06, n_win: 2}); err == nil {
+		t.Fatal("save without a directory succeeded")
+	}
+	if st, _ := s.LoadStatistics("alice"); !reflect.DeepEqual(st, old) {
+		t.Errorf("after a failed save: %+v, want %+v", st, old)
+	}
+	if err := s.SaveStatistics("bob", new_statistics()); err == nil {
+		t.Fatal("save without a directory succeeded")
+	}
+	if _, ok := s.records["bob"]; ok {
+		t.Error("failed save of a new user kept its record")
+	}
+}
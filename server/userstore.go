@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// LOGOUT reasons of failed logins and registrations
+var (
+	err_wrong_password = errors.New("WRONG PASSWORD")
+	err_unknown_user = errors.New("UNKNOWN USER")
+	err_user_disabled = errors.New("ACCOUNT DISABLED")
+	err_user_exists = errors.New("USERID ALREADY REGISTERED")
+	err_duplicate_login = errors.New("DUPLICATE LOGIN ATTEMPT")
+)
+
+// UserStore keeps the accounts of the users.
+type UserStore interface {
+	// Register adds an account, or returns err_user_exists.
+	Register(userid string, password string) error
+	// Authenticate returns nil if the password is right and the account
+	// enabled, or the reason to refuse the login.
+	Authenticate(userid string, password string) error
+	SetDisabled(userid string, disabled bool) error
+}
+
+// Account is a user of a FileUserStore. Passwords are kept as salted
+// PBKDF2-SHA256 hashes.
+type Account struct {
+	Userid     string
+	Salt       []byte
+	Hash       []byte
+	Iterations int
+	Disabled   bool
+	Created    int64
+}
+
+const (
+	password_iterations = 100000
+	password_salt_len = 16
+	password_hash_len = 32
+)
+
+func hash_password(password string, salt []byte, iterations int) []byte {
+	return pbkdf2.Key([]byte(password), salt, iterations, password_hash_len, sha256.New)
+}
+
+// FileUserStore is a UserStore saved as a JSON file, reread before every
+// login and change and rewritten on every change.
+type FileUserStore struct {
+	name string
+	accounts map[string]*Account
+	mu sync.Mutex
+}
+
+// open_user_store loads the accounts of the file name, which need not
+// exist yet.
+func open_user_store(name string) (*FileUserStore, error) {
+	s := &FileUserStore{name: name}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load rereads the accounts, which a server run with -disable or -enable
+// may have changed since. s.mu is held.
+func (s *FileUserStore) load() error {
+	accounts := make(map[string]*Account)
+	b, err := os.ReadFile(s.name)
+	if os.IsNotExist(err) {
+		s.accounts = accounts
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var list []*Account
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	for _, a := range list {
+		accounts[a.Userid] = a
+	}
+	s.accounts = accounts
+	return nil
+}
+
+// save writes the accounts. s.mu is held.
+func (s *FileUserStore) save() error {
+	accounts := make([]*Account, 0, len(s.accounts))
+	for _, a := range s.accounts {
+		accounts = append(accounts, a)
+	}
+	return write_json_file(s.name, accounts)
+}
+
+// write_json_file writes v to a temporary file renamed over name, so that
+// a crash leaves either the old or the new file.
+func write_json_file(name string, v any) error {
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name) + ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *FileUserStore) Register(userid string, password string) error {
+	salt := make([]byte, password_salt_len)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	a := &Account{
+		Userid: userid,
+		Salt: salt,
+		Hash: hash_password(password, salt, password_iterations),
+		Iterations: password_iterations,
+		Created: time.Now().Unix(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.accounts[userid]; ok {
+		return err_user_exists
+	}
+	s.accounts[userid] = a
+	if err := s.save(); err != nil {
+		delete(s.accounts, userid)
+		return err
+	}
+	return nil
+}
+
+func (s *FileUserStore) Authenticate(userid string, password string) error {
+	s.mu.Lock()
+	err := s.load()
+	a, ok := s.accounts[userid]
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return err_unknown_user
+	}
+	// a is replaced rather than changed by the next load
+	h := hash_password(password, a.Salt, a.Iterations)
+	if subtle.ConstantTimeCompare(h, a.Hash) != 1 {
+		return err_wrong_password
+	}
+	if a.Disabled {
+		return err_user_disabled
+	}
+	return nil
+}
+
+func (s *FileUserStore) SetDisabled(userid string, disabled bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	a, ok := s.accounts[userid]
+	if !ok {
+		return err_unknown_user
+	}
+	old := a.Disabled
+	a.Disabled = disabled
+	if err := s.save(); err != nil {
+		a.Disabled = old
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestFileUserStore(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "users.json")
+	s, err := open_user_store(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Authenticate("alice", "secret"); err != err_unknown_user {
+		t.Errorf("unknown user: %v", err)
+	}
+	if err := s.Register("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("alice", "other"); err != err_user_exists {
+		t.Errorf("duplicate registration: %v", err)
+	}
+	if err := s.Authenticate("alice", "secret"); err != nil {
+		t.Errorf("right password: %v", err)
+	}
+	if err := s.Authenticate("alice", "other"); err != err_wrong_password {
+		t.Errorf("wrong password: %v", err)
+	}
+	if err := s.SetDisabled("bob", true); err != err_unknown_user {
+		t.Errorf("disabling an unknown user: %v", err)
+	}
+	if err := s.SetDisabled("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Authenticate("alice", "secret"); err != err_user_disabled {
+		t.Errorf("disabled account: %v", err)
+	}
+
+	// a second store on the file, as a server run with -enable
+	s2, err := open_user_store(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s2.Authenticate("alice", "secret"); err != err_user_disabled {
+		t.Errorf("reopened disabled account: %v", err)
+	}
+	if err := s2.SetDisabled("alice", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Authenticate("alice", "secret"); err != nil {
+		t.Errorf("account enabled by another store: %v", err)
+	}
+	// a registration does not save over the change of the other store
+	if err := s2.Register("bob", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetDisabled("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register("carol", "pass"); err != nil {
+		t.Fatal(err)
+	}
+	s3, err := open_user_store(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		userid, password string
+		err error
+	}{
+		{"alice", "secret", err_user_disabled},
+		{"bob", "hunter2", nil},
+		{"carol", "pass", nil},
+		{"carol", "hunter2", err_wrong_password},
+	} {
+		if err := s3.Authenticate(c.userid, c.password); err != c.err {
+			t.Errorf("%s after reopening: %v, want %v", c.userid, err, c.err)
+		}
+	}
+}
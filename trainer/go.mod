@@ -0,0 +1,15 @@
+module trainer
+
+go 1.18
+
+replace game => ../game
+
+replace records => ../records
+
+replace eval => ../eval
+
+require (
+	eval v0.0.0-00010101000000-000000000000
+	game v0.0.0-00010101000000-000000000000
+	records v0.0.0-00010101000000-000000000000
+)
@@ -0,0 +1,135 @@
+// trainer fits the weights of the 8x8 pattern evaluator (eval.Pattern) to
+// the results of recorded games.
+//
+// Each input line is one 8x8 game, in a format read by package records.
+// Games that were not played to the end are skipped, since their final
+// disc difference is unknown.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"eval"
+	"game"
+	"records"
+)
+
+// replay plays moves from b and labels every position with a legal move
+// by the final disc difference for its side to move.
+func replay(p *eval.Pattern, b *game.Board, moves []string) ([]eval.PatternSample, error) {
+	var samples []eval.PatternSample
+	var turns []int
+	for _, s := range moves {
+		mv, err := b.Str2Position(s)
+		if err != nil {
+			return nil, err
+		}
+		if !b.IsLegalMove(mv) {
+			return nil, fmt.Errorf("illegal move %s", s)
+		}
+		if mv != -1 {
+			samples = append(samples, eval.PatternSample{Features: p.Features(b, nil)})
+			turns = append(turns, b.Turn)
+		}
+		b.MoveUpdate(mv)
+	}
+	if !b.IsGameOver() {
+		return nil, errors.New("game not finished")
+	}
+	diff := float32(b.CountBlack() - b.CountWhite())
+	for i, turn := range turns {
+		samples[i].Score = diff
+		if turn == game.White {
+			samples[i].Score = -diff
+		}
+	}
+	return samples, nil
+}
+
+func read_games(p *eval.Pattern, r io.Reader, name string) ([]eval.PatternSample, error) {
+	var samples []eval.PatternSample
+	err := records.Read(r, name, 8, func(b *game.Board, moves []string) error {
+		s, err := replay(p, b, moves)
+		samples = append(samples, s...)
+		return err
+	})
+	return samples, err
+}
+
+func main() {
+	in := flag.String("in", "", "initial weights file, none to start from zero")
+	out := flag.String("out", "pattern.bin", "weights file to write")
+	epochs := flag.Int("epochs", 200, "gradient descent steps")
+	rate := flag.Float64("rate", 1, "learning rate, up to 1")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [game files]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	p := eval.NewPattern()
+	if *in != "" {
+		f, err := os.Open(*in)
+		if err != nil {
+			log.Fatal(err)
+		}
+		p, err = eval.ReadPattern(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", *in, err)
+		}
+	}
+
+	var samples []eval.PatternSample
+	if flag.NArg() == 0 {
+		s, err := read_games(p, os.Stdin, "stdin")
+		if err != nil {
+			log.Fatal(err)
+		}
+		samples = s
+	}
+	for _, name := range flag.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s, err := read_games(p, f, name)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", name, err)
+		}
+		samples = append(samples, s...)
+	}
+	if len(samples) == 0 {
+		log.Fatal("no positions to train on")
+	}
+	log.Println("positions =", len(samples))
+
+	for i := 0; i < *epochs; i++ {
+		mse := p.Fit(samples, *rate)
+		if i % 10 == 0 || i == *epochs-1 {
+			log.Printf("epoch %d mean squared error = %.3f", i, mse)
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	if err = p.Write(w); err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", *out, err)
+	}
+}